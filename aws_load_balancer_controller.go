@@ -0,0 +1,384 @@
+package taloscdk
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+
+	"github.com/aws/aws-cdk-go/awscdk"
+	"github.com/aws/aws-cdk-go/awscdk/awsec2"
+	"github.com/aws/aws-cdk-go/awscdk/awsiam"
+	"github.com/aws/constructs-go/constructs/v3"
+	"github.com/aws/jsii-runtime-go"
+)
+
+type AWSLoadBalancerControllerProps struct {
+	// InlineManifests adds the controller to the control plane config as a Talos inline manifest, running it
+	// on the control plane nodes with the control plane IAM role. Its CRDs are added as an extra manifest.
+	// The webhook certificate is issued by cert-manager, which has to be installed separately (e.g. from
+	// cluster.extraManifests), otherwise the controller doesn't start.
+	// Default: jsii.Bool(false) (only the IAM permissions, install the controller e.g. with its Helm chart)
+	InlineManifests *bool
+
+	// Version of the AWS Load Balancer Controller, used for the image and the CRDs
+	// Default: v2.11.0
+	Version *string
+
+	// ExtraArgs are appended to the controller's arguments, e.g. "--default-target-type=ip"
+	// Default: nil
+	ExtraArgs []string
+}
+
+// awsLoadBalancerControllerManifest is based on the upstream v2_x_full.yaml, without the service mutator webhook.
+// Services of type LoadBalancer stay with the cloud provider unless annotated with
+// service.beta.kubernetes.io/aws-load-balancer-type: external
+var awsLoadBalancerControllerManifest = template.Must(template.New("aws-load-balancer-controller").Parse(`apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: aws-load-balancer-controller
+  namespace: kube-system
+  labels:
+    app.kubernetes.io/name: aws-load-balancer-controller
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: aws-load-balancer-controller-role
+  labels:
+    app.kubernetes.io/name: aws-load-balancer-controller
+rules:
+  - apiGroups: [""]
+    resources: ["endpoints", "namespaces", "nodes", "pods", "secrets"]
+    verbs: ["get", "list", "watch"]
+  - apiGroups: [""]
+    resources: ["events"]
+    verbs: ["create", "patch"]
+  - apiGroups: [""]
+    resources: ["pods/status", "services/status"]
+    verbs: ["patch", "update"]
+  - apiGroups: [""]
+    resources: ["services"]
+    verbs: ["get", "list", "patch", "update", "watch"]
+  - apiGroups: ["discovery.k8s.io"]
+    resources: ["endpointslices"]
+    verbs: ["get", "list", "watch"]
+  - apiGroups: ["elbv2.k8s.aws"]
+    resources: ["ingressclassparams"]
+    verbs: ["get", "list", "watch"]
+  - apiGroups: ["elbv2.k8s.aws"]
+    resources: ["targetgroupbindings"]
+    verbs: ["create", "delete", "get", "list", "patch", "update", "watch"]
+  - apiGroups: ["elbv2.k8s.aws"]
+    resources: ["targetgroupbindings/status"]
+    verbs: ["patch", "update"]
+  - apiGroups: ["extensions", "networking.k8s.io"]
+    resources: ["ingresses"]
+    verbs: ["get", "list", "patch", "update", "watch"]
+  - apiGroups: ["extensions", "networking.k8s.io"]
+    resources: ["ingresses/status"]
+    verbs: ["patch", "update"]
+  - apiGroups: ["networking.k8s.io"]
+    resources: ["ingressclasses"]
+    verbs: ["get", "list", "watch"]
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: aws-load-balancer-controller-rolebinding
+  labels:
+    app.kubernetes.io/name: aws-load-balancer-controller
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: aws-load-balancer-controller-role
+subjects:
+  - kind: ServiceAccount
+    name: aws-load-balancer-controller
+    namespace: kube-system
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: Role
+metadata:
+  name: aws-load-balancer-controller-leader-election-role
+  namespace: kube-system
+  labels:
+    app.kubernetes.io/name: aws-load-balancer-controller
+rules:
+  - apiGroups: [""]
+    resources: ["configmaps"]
+    verbs: ["create"]
+  - apiGroups: [""]
+    resources: ["configmaps"]
+    resourceNames: ["aws-load-balancer-controller-leader"]
+    verbs: ["get", "patch", "update"]
+  - apiGroups: ["coordination.k8s.io"]
+    resources: ["leases"]
+    verbs: ["create"]
+  - apiGroups: ["coordination.k8s.io"]
+    resources: ["leases"]
+    resourceNames: ["aws-load-balancer-controller-leader"]
+    verbs: ["get", "update", "patch"]
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: aws-load-balancer-controller-leader-election-rolebinding
+  namespace: kube-system
+  labels:
+    app.kubernetes.io/name: aws-load-balancer-controller
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: Role
+  name: aws-load-balancer-controller-leader-election-role
+subjects:
+  - kind: ServiceAccount
+    name: aws-load-balancer-controller
+    namespace: kube-system
+---
+apiVersion: cert-manager.io/v1
+kind: Issuer
+metadata:
+  name: aws-load-balancer-selfsigned-issuer
+  namespace: kube-system
+  labels:
+    app.kubernetes.io/name: aws-load-balancer-controller
+spec:
+  selfSigned: {}
+---
+apiVersion: cert-manager.io/v1
+kind: Certificate
+metadata:
+  name: aws-load-balancer-serving-cert
+  namespace: kube-system
+  labels:
+    app.kubernetes.io/name: aws-load-balancer-controller
+spec:
+  dnsNames:
+    - aws-load-balancer-webhook-service.kube-system.svc
+    - aws-load-balancer-webhook-service.kube-system.svc.cluster.local
+  issuerRef:
+    kind: Issuer
+    name: aws-load-balancer-selfsigned-issuer
+  secretName: aws-load-balancer-webhook-tls
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: aws-load-balancer-webhook-service
+  namespace: kube-system
+  labels:
+    app.kubernetes.io/name: aws-load-balancer-controller
+spec:
+  ports:
+    - port: 443
+      targetPort: 9443
+  selector:
+    app.kubernetes.io/name: aws-load-balancer-controller
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: aws-load-balancer-controller
+  namespace: kube-system
+  labels:
+    app.kubernetes.io/name: aws-load-balancer-controller
+spec:
+  replicas: 2
+  selector:
+    matchLabels:
+      app.kubernetes.io/name: aws-load-balancer-controller
+  template:
+    metadata:
+      labels:
+        app.kubernetes.io/name: aws-load-balancer-controller
+    spec:
+      priorityClassName: system-cluster-critical
+      serviceAccountName: aws-load-balancer-controller
+      securityContext:
+        fsGroup: 65534
+      # Runs on the control plane to use its instance profile
+      nodeSelector:
+        node-role.kubernetes.io/control-plane: ""
+      tolerations:
+        - key: node-role.kubernetes.io/control-plane
+          operator: Exists
+          effect: NoSchedule
+      containers:
+        - name: controller
+          image: public.ecr.aws/eks/aws-load-balancer-controller:{{ .Version }}
+          args:
+            - --cluster-name={{ .ClusterName }}
+            - --ingress-class=alb
+            - --aws-region={{ .Region }}
+            - --aws-vpc-id={{ .VpcID }}
+            - --enable-service-mutator-webhook=false
+{{- range .ExtraArgs }}
+            - {{ . }}
+{{- end }}
+          ports:
+            - name: webhook-server
+              containerPort: 9443
+              protocol: TCP
+          livenessProbe:
+            httpGet:
+              path: /healthz
+              port: 61779
+            initialDelaySeconds: 30
+            timeoutSeconds: 10
+            failureThreshold: 2
+          resources:
+            limits:
+              cpu: 200m
+              memory: 500Mi
+            requests:
+              cpu: 100m
+              memory: 200Mi
+          securityContext:
+            allowPrivilegeEscalation: false
+            readOnlyRootFilesystem: true
+            runAsNonRoot: true
+          volumeMounts:
+            - name: cert
+              mountPath: /tmp/k8s-webhook-server/serving-certs
+              readOnly: true
+      volumes:
+        - name: cert
+          secret:
+            defaultMode: 420
+            secretName: aws-load-balancer-webhook-tls
+---
+apiVersion: admissionregistration.k8s.io/v1
+kind: MutatingWebhookConfiguration
+metadata:
+  name: aws-load-balancer-webhook
+  annotations:
+    cert-manager.io/inject-ca-from: kube-system/aws-load-balancer-serving-cert
+  labels:
+    app.kubernetes.io/name: aws-load-balancer-controller
+webhooks:
+  - name: mpod.elbv2.k8s.aws
+    admissionReviewVersions: ["v1beta1"]
+    clientConfig:
+      service:
+        name: aws-load-balancer-webhook-service
+        namespace: kube-system
+        path: /mutate-v1-pod
+    failurePolicy: Fail
+    namespaceSelector:
+      matchExpressions:
+        - key: elbv2.k8s.aws/pod-readiness-gate-inject
+          operator: In
+          values: ["enabled"]
+    objectSelector:
+      matchExpressions:
+        - key: app.kubernetes.io/name
+          operator: NotIn
+          values: ["aws-load-balancer-controller"]
+    rules:
+      - apiGroups: [""]
+        apiVersions: ["v1"]
+        operations: ["CREATE"]
+        resources: ["pods"]
+    sideEffects: None
+  - name: mtargetgroupbinding.elbv2.k8s.aws
+    admissionReviewVersions: ["v1beta1"]
+    clientConfig:
+      service:
+        name: aws-load-balancer-webhook-service
+        namespace: kube-system
+        path: /mutate-elbv2-k8s-aws-v1beta1-targetgroupbinding
+    failurePolicy: Fail
+    rules:
+      - apiGroups: ["elbv2.k8s.aws"]
+        apiVersions: ["v1beta1"]
+        operations: ["CREATE", "UPDATE"]
+        resources: ["targetgroupbindings"]
+    sideEffects: None
+---
+apiVersion: admissionregistration.k8s.io/v1
+kind: ValidatingWebhookConfiguration
+metadata:
+  name: aws-load-balancer-webhook
+  annotations:
+    cert-manager.io/inject-ca-from: kube-system/aws-load-balancer-serving-cert
+  labels:
+    app.kubernetes.io/name: aws-load-balancer-controller
+webhooks:
+  - name: vtargetgroupbinding.elbv2.k8s.aws
+    admissionReviewVersions: ["v1beta1"]
+    clientConfig:
+      service:
+        name: aws-load-balancer-webhook-service
+        namespace: kube-system
+        path: /validate-elbv2-k8s-aws-v1beta1-targetgroupbinding
+    failurePolicy: Fail
+    rules:
+      - apiGroups: ["elbv2.k8s.aws"]
+        apiVersions: ["v1beta1"]
+        operations: ["CREATE", "UPDATE"]
+        resources: ["targetgroupbindings"]
+    sideEffects: None
+  - name: vingress.elbv2.k8s.aws
+    admissionReviewVersions: ["v1beta1"]
+    clientConfig:
+      service:
+        name: aws-load-balancer-webhook-service
+        namespace: kube-system
+        path: /validate-networking-v1-ingress
+    failurePolicy: Fail
+    matchPolicy: Equivalent
+    rules:
+      - apiGroups: ["networking.k8s.io"]
+        apiVersions: ["v1"]
+        operations: ["CREATE", "UPDATE"]
+        resources: ["ingresses"]
+    sideEffects: None
+---
+apiVersion: networking.k8s.io/v1
+kind: IngressClass
+metadata:
+  name: alb
+  labels:
+    app.kubernetes.io/name: aws-load-balancer-controller
+spec:
+  controller: ingress.k8s.aws/alb
+`))
+
+// NewAWSLoadBalancerControllerManifest returns the AWS Load Balancer Controller manifests (without CRDs, see
+// AWSLoadBalancerControllerCRDsURL) for clusterName, managing load balancers in vpc.
+func NewAWSLoadBalancerControllerManifest(scope constructs.Construct, clusterName string, vpc awsec2.IVpc, props *AWSLoadBalancerControllerProps) *string {
+	if props == nil {
+		props = &AWSLoadBalancerControllerProps{}
+	}
+
+	if props.Version == nil {
+		props.Version = jsii.String("v2.11.0")
+	}
+
+	var manifest bytes.Buffer
+	err := awsLoadBalancerControllerManifest.Execute(&manifest, map[string]interface{}{
+		"ClusterName": clusterName,
+		"Version":     *props.Version,
+		"VpcID":       *vpc.VpcId(),
+		"Region":      *awscdk.Stack_Of(scope).Region(),
+		"ExtraArgs":   props.ExtraArgs,
+	})
+	if err != nil {
+		panic(fmt.Sprintf("Could not render AWS Load Balancer Controller manifest: %v", err))
+	}
+
+	return jsii.String(manifest.String())
+}
+
+// AWSLoadBalancerControllerCRDsURL returns the URL of the controller's CRDs (TargetGroupBinding and
+// IngressClassParams) for version, for use in cluster.extraManifests
+func AWSLoadBalancerControllerCRDsURL(version string) string {
+	return fmt.Sprintf("https://raw.githubusercontent.com/kubernetes-sigs/aws-load-balancer-controller/%s/helm/aws-load-balancer-controller/crds/crds.yaml", version)
+}
+
+// GrantAWSLoadBalancerController allows role to run the AWS Load Balancer Controller, see
+// AWSLoadBalancerControllerPolicyModule(). Grant it to the role of the nodes running the controller,
+// the control plane role when using the inline manifests.
+func GrantAWSLoadBalancerController(role awsiam.IRole) {
+	NewIAMPolicyBuilder(AWSLoadBalancerControllerPolicyModule()).Grant(role)
+}
@@ -0,0 +1,78 @@
+package taloscdk
+
+import (
+	"github.com/aws/aws-cdk-go/awscdk"
+	"github.com/aws/aws-cdk-go/awscdk/awsec2"
+	"github.com/aws/aws-cdk-go/awscdk/awsiam"
+	"github.com/aws/aws-cdk-go/awscdk/awssecretsmanager"
+	"github.com/aws/aws-cdk-go/awscdk/customresources"
+	"github.com/aws/jsii-runtime-go"
+)
+
+type bootstrapProps struct {
+	Vpc         awsec2.IVpc
+	Subnets     *awsec2.SubnetSelection
+	NodeSG      awsec2.SecurityGroup
+	Talosconfig awssecretsmanager.ISecret
+	Timeout     awscdk.Duration
+
+	// Kubeconfig secret the admin kubeconfig is written to once etcd is healthy (optional)
+	Kubeconfig awssecretsmanager.ISecret
+
+	// Either the control plane ASG names, or the endpoints of the node to bootstrap
+	AutoScalingGroupNames []*string
+	Endpoints             []*string
+}
+
+// newBootstrap returns a Custom::TalosBootstrap resource that finishes creating once the first control
+// plane node has been bootstrapped and etcd is healthy (and the kubeconfig has been stored, if requested).
+// The Talos bootstrap is only run on create.
+func newBootstrap(scope awscdk.Construct, props *bootstrapProps) awscdk.CustomResource {
+	if props.Talosconfig == nil {
+		panic("Bootstrap requires a TalosconfigSecret")
+	}
+
+	if props.Timeout == nil {
+		props.Timeout = awscdk.Duration_Minutes(jsii.Number(30))
+	}
+
+	fn := newTalosAPIFunction(scope, jsii.String("BootstrapFunction"), "bootstrap", props.Vpc, props.Subnets, props.NodeSG, props.Talosconfig, nil, awscdk.Duration_Minutes(jsii.Number(15)))
+	fn.AddToRolePolicy(awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
+		Effect: awsiam.Effect_ALLOW,
+		Actions: jsii.Strings(
+			"autoscaling:DescribeAutoScalingGroups",
+			"ec2:DescribeInstances",
+		),
+		Resources: jsii.Strings("*"),
+	}))
+
+	provider := customresources.NewProvider(scope, jsii.String("BootstrapProvider"), &customresources.ProviderProps{
+		OnEventHandler:    fn,
+		IsCompleteHandler: fn,
+		QueryInterval:     awscdk.Duration_Seconds(jsii.Number(30)),
+		TotalTimeout:      props.Timeout,
+	})
+
+	properties := map[string]interface{}{}
+	if props.AutoScalingGroupNames != nil {
+		properties["AutoScalingGroupNames"] = props.AutoScalingGroupNames
+	}
+	if props.Endpoints != nil {
+		properties["Endpoints"] = props.Endpoints
+	}
+	if props.Kubeconfig != nil {
+		properties["KubeconfigSecretArn"] = props.Kubeconfig.SecretArn()
+		props.Kubeconfig.GrantWrite(fn)
+	}
+
+	bootstrap := awscdk.NewCustomResource(scope, jsii.String("Bootstrap"), &awscdk.CustomResourceProps{
+		ServiceToken: provider.ServiceToken(),
+		ResourceType: jsii.String("Custom::TalosBootstrap"),
+		Properties:   &properties,
+	})
+
+	// The Lambda's access to the Talos API is an ingress rule on the node security group
+	bootstrap.Node().AddDependency(props.NodeSG)
+
+	return bootstrap
+}
@@ -8,6 +8,8 @@ import (
 	"github.com/aws/aws-cdk-go/awscdk/awsec2"
 	awselbv2 "github.com/aws/aws-cdk-go/awscdk/awselasticloadbalancingv2"
 	"github.com/aws/aws-cdk-go/awscdk/awsiam"
+	"github.com/aws/aws-cdk-go/awscdk/awss3"
+	"github.com/aws/aws-cdk-go/awscdk/awssecretsmanager"
 	"github.com/aws/constructs-go/constructs/v3"
 	"github.com/aws/jsii-runtime-go"
 )
@@ -64,9 +66,34 @@ type ControlPlaneProps struct {
 	// SecurityGroup for the instance.
 	// To create a security group to use with multiple images, you can use:
 	// taloscdk.NewSecutiyGroup()
-	// Default: Generates a new security group, opening ports: 6443, 50000, 50001 to the any peer
+	// Default: Generates a new security group, opening port 6443 to any peer. The Talos API (50000, 50001)
+	// is not opened, create the group with SecurityGroupProps.TalosAPIPeers to use talosctl from outside of it
 	SecurityGroup awsec2.SecurityGroup
 
+	// RestrictedEgress creates the default security group with explicit outbound rules instead of allowing all
+	// outbound traffic, and points machine.time.servers at the allowed time servers.
+	// See SecurityGroupProps.RestrictedEgress.
+	// Default: nil (all outbound traffic is allowed)
+	RestrictedEgress *EgressProps
+
+	// KubeSpan enables KubeSpan and cluster discovery in TalosNodeConfig and opens the WireGuard port (UDP 51820)
+	// in the default security group. Enable it on the workers as well, with the control plane's SecurityGroup in
+	// KubeSpanProps.NodeSecurityGroups if they get a default security group of their own.
+	// Requires Talos v1.0 or later, the stack panics on older MachineImageName images.
+	// Default: nil (KubeSpan disabled)
+	KubeSpan *KubeSpanProps
+
+	// DualStack adds IPv6 pod and service CIDRs to TalosNodeConfig, makes the NLB dualstack and opens the default
+	// security group to IPv6. SubnetSelection and the NLB subnets need IPv6 CIDRs, and the nodes only get IPv6
+	// addresses from subnets that assign them, see AssignIpv6Addresses().
+	// Default: nil (IPv4 only)
+	DualStack *DualStackProps
+
+	// ClusterSecurityGroups from NewClusterSecurityGroups() replaces SecurityGroup with its ControlPlane group
+	// and attaches its LoadBalancer group to the NLB. Adding it to an existing control plane replaces the NLB.
+	// Default: nil
+	ClusterSecurityGroups *ClusterSecurityGroups
+
 	// Vpc selects the AWS VPC to deploy your instance into.
 	// Default for NewSingleNode(): Default VPC
 	Vpc awsec2.IVpc
@@ -87,7 +114,17 @@ type ControlPlaneProps struct {
 	// If planning to create AWS load balancers, it's best to use
 	// taloscdk.NewControlPlaneIAMRole() or taloscdk.NewWorkerIAMRole()
 	// Default: NewControlPlaneIAMRole()
-	IAMRole awsiam.Role
+	IAMRole awsiam.IRole
+
+	// IAMRoleProps configure the default IAMRole (permissions boundary, path, managed policies, name prefix).
+	// Ignored if IAMRole is set.
+	// Default: nil
+	IAMRoleProps *IAMRoleProps
+
+	// ScopedIAMPolicy creates the default IAMRole with NewScopedControlPlaneIAMRole(), which only allows
+	// mutating actions on resources tagged kubernetes.io/cluster/<ClusterName>. Ignored if IAMRole is set.
+	// Default: jsii.Bool(false)
+	ScopedIAMPolicy *bool
 
 	// DesiredCapacity of the autoscaling group
 	// Best practice: leave it nil. If you set a value, it will always reset the number of
@@ -99,15 +136,166 @@ type ControlPlaneProps struct {
 	// created in public subnets (or left in the private subnets)
 	// Default: jsii.Bool(true)
 	InternetFacingNLB *bool
+
+	// CrossZoneLoadBalancing enables cross-zone load balancing on the control plane NLB, so each
+	// NLB node spreads API requests across control plane nodes in every AZ.
+	// Default: jsii.Bool(false)
+	CrossZoneLoadBalancing *bool
+
+	// NLBDeletionProtection prevents the control plane NLB from being deleted. Recommended for production clusters.
+	// Default: jsii.Bool(false)
+	NLBDeletionProtection *bool
+
+	// NLBAccessLogs enables access logging on the control plane NLB. If no Bucket is given,
+	// an encrypted bucket with lifecycle rules is created. Requires an explicit region on the stack.
+	// It has no effect without a TLS listener: NLBs only write access logs for TLS listeners, and the control
+	// plane NLB only has a TCP listener on 6443.
+	// Add a TLS listener to ControlPlane.NLB to get logs; a synth warning is shown as a reminder.
+	// Default: nil (access logs disabled)
+	NLBAccessLogs *NLBAccessLogsProps
+
+	// Topology controls how control plane instances are grouped into autoscaling groups.
+	// ControlPlaneTopologyPerAZ creates one single-instance ASG per AZ in SubnetSelection, pinning
+	// each etcd member to an AZ. MinInstances, MaxInstances and DesiredCapacity are ignored in that mode.
+	// Default: ControlPlaneTopologySingleASG
+	Topology ControlPlaneTopology
+
+	// StablePrivateIPs pre-creates one ENI per control plane slot and attaches it to each launched
+	// instance (as its second interface) with a lifecycle hook, so node IPs survive replacement.
+	// The ENI is configured as eth1 and kubelet and etcd are patched to advertise its address. Talos can't
+	// route replies from eth1 through eth1 itself, so the source/destination check of their eth0 is disabled.
+	// Requires Topology: ControlPlaneTopologyPerAZ
+	// Default: jsii.Bool(false)
+	StablePrivateIPs *bool
+
+	// PrivateIPs pins the address of each stable ENI, one per AZ in the order of SubnetSelection.
+	// Only used with StablePrivateIPs.
+	// Default: addresses are assigned by the subnet
+	PrivateIPs *[]*string
+
+	// TalosconfigSecret is a Secrets Manager secret containing a talosconfig for the cluster, e.g. from
+	// NewClusterSecrets(). Lambda-backed features (such as EtcdMemberCleanup) use it to call the Talos API.
+	// Default: nil
+	TalosconfigSecret awssecretsmanager.ISecret
+
+	// TalosAPIFunctionSubnets are the subnets for Lambda functions that call the Talos API.
+	// They need a route to AWS APIs, through a NAT gateway or VPC endpoints.
+	// Default: &awsec2.SubnetSelection{SubnetType: awsec2.SubnetType_PRIVATE}
+	TalosAPIFunctionSubnets *awsec2.SubnetSelection
+
+	// EtcdMemberCleanup adds a termination lifecycle hook that removes a node from etcd before
+	// the ASG releases it, so scale-in and replacements don't leave stale members behind.
+	// Requires TalosconfigSecret.
+	// Default: jsii.Bool(false)
+	EtcdMemberCleanup *bool
+
+	// Bootstrap adds a custom resource that waits for the first control plane node, runs the Talos
+	// bootstrap once and waits for etcd to be healthy, so `cdk deploy` ends with a working cluster.
+	// This replaces running `talosctl bootstrap` by hand. Requires TalosconfigSecret.
+	// Default: jsii.Bool(false)
+	Bootstrap *bool
+
+	// BootstrapTimeout is how long to wait for the node to boot and etcd to become healthy.
+	// Default: awscdk.Duration_Minutes(jsii.Number(30))
+	BootstrapTimeout awscdk.Duration
+
+	// KubeconfigSecret receives the admin kubeconfig once Bootstrap is done, e.g. from NewClusterSecrets().
+	// Requires Bootstrap.
+	// Default: nil
+	KubeconfigSecret awssecretsmanager.ISecret
+
+	// ConfigDelivery determines how TalosNodeConfig reaches the nodes. With ConfigDeliveryMaintenanceMode,
+	// instances boot without user data and the config is applied from MachineConfigSecret through the
+	// Talos maintenance API by a Lambda in TalosAPIFunctionSubnets.
+	// Default: ConfigDeliveryUserData
+	ConfigDelivery ConfigDelivery
+
+	// MachineConfigSecret holding the machine config for ConfigDeliveryMaintenanceMode.
+	// Default: a secret is created from TalosNodeConfig with NewMachineConfigSecret()
+	MachineConfigSecret awssecretsmanager.ISecret
+
+	// WaitForReady adds a creation policy to the control plane ASG(s), so the stack only finishes creating
+	// once every node passes ReadinessCheck. A Lambda in TalosAPIFunctionSubnets polls the nodes and sends
+	// the CloudFormation signals every minute. It disables its schedule once the stack is done, and updates that
+	// replace the ASGs enable it again.
+	// Requires TalosconfigSecret.
+	// Default: jsii.Bool(false)
+	WaitForReady *bool
+
+	// ReadinessCheck used by WaitForReady. ReadinessCheckKubernetes can't be combined with Bootstrap.
+	// Default: ReadinessCheckTalos
+	ReadinessCheck ReadinessCheck
+
+	// ReadyTimeout is how long CloudFormation waits for the nodes before failing the stack.
+	// Default: awscdk.Duration_Minutes(jsii.Number(30))
+	ReadyTimeout awscdk.Duration
+
+	// ClusterAutoscaler grants the control plane IAM role the permissions of the cluster autoscaler and
+	// (by default) runs it from an inline manifest. Enable it on worker groups with WorkerASGProps.ClusterAutoscaler.
+	// Default: nil (no cluster autoscaler)
+	ClusterAutoscaler *ClusterAutoscalerProps
+
+	// EBSCSIDriver grants the control plane IAM role the permissions of the EBS CSI driver and (by default)
+	// installs the driver and a default gp3 StorageClass from inline manifests.
+	// Default: nil (no EBS CSI driver)
+	EBSCSIDriver *EBSCSIDriverProps
+
+	// AWSLoadBalancerController grants the control plane IAM role the permissions of the AWS Load Balancer
+	// Controller and optionally runs it from an inline manifest, wired to ClusterName and Vpc.
+	// Default: nil (no AWS Load Balancer Controller)
+	AWSLoadBalancerController *AWSLoadBalancerControllerProps
+
+	// ImageMirror from NewImageMirror() pulls images through ECR: the IAM role gets pull permissions
+	// and machine.registries.mirrors is patched into TalosNodeConfig. If the mirror refreshes ECR credentials
+	// (TalosconfigSecret), the nodes need Talos v1.0 or later.
+	// Default: nil (images are pulled from their registries)
+	ImageMirror *ImageMirror
+
+	// ECRCredentialProvider configures kubelet to pull private ECR images with the IAM role's credentials,
+	// using ecr-credential-provider from a Talos system extension. The extension isn't installed, it has to be
+	// part of the image (see ECRCredentialProviderConfigPatch()), and the stack panics on older MachineImageName
+	// images than Talos v1.0. The IAM role gets ECR pull permissions.
+	// Default: nil (no kubelet credential provider)
+	ECRCredentialProvider *ECRCredentialProviderProps
 }
 
+// ControlPlaneTopology determines how control plane nodes are spread across autoscaling groups
+type ControlPlaneTopology string
+
+const (
+	// ControlPlaneTopologySingleASG uses one ASG spanning every selected subnet
+	ControlPlaneTopologySingleASG ControlPlaneTopology = "single-asg"
+
+	// ControlPlaneTopologyPerAZ uses one single-instance ASG per AZ, so AZ rebalancing
+	// never moves or terminates more than one etcd member at a time
+	ControlPlaneTopologyPerAZ ControlPlaneTopology = "per-az"
+)
+
 type ControlPlane struct {
 	constructs.Construct
 	SecurityGroup awsec2.SecurityGroup
 	Vpc           awsec2.IVpc
-	ASG           awsautoscaling.AutoScalingGroup
-	NLB           awselbv2.NetworkLoadBalancer
-	IAMRole       awsiam.Role
+
+	// ASG of the control plane. nil when using ControlPlaneTopologyPerAZ, use ASGs instead.
+	ASG awsautoscaling.AutoScalingGroup
+
+	// ASGs contains every control plane autoscaling group (one per AZ with ControlPlaneTopologyPerAZ)
+	ASGs []awsautoscaling.AutoScalingGroup
+
+	NLB     awselbv2.NetworkLoadBalancer
+	IAMRole awsiam.IRole
+
+	// AccessLogsBucket receiving the NLB access logs (if enabled)
+	AccessLogsBucket awss3.IBucket
+
+	// PrivateIPs of the control plane nodes when using StablePrivateIPs
+	PrivateIPs []*string
+
+	// Bootstrap custom resource (if enabled). Add a dependency on it for resources that need a running cluster.
+	Bootstrap awscdk.CustomResource
+	// TalosconfigSecret and KubeconfigSecret (if given), their ARNs are also stack outputs
+	TalosconfigSecret awssecretsmanager.ISecret
+	KubeconfigSecret  awssecretsmanager.ISecret
 }
 
 type WorkerASGProps struct {
@@ -162,9 +350,30 @@ type WorkerASGProps struct {
 	// SecurityGroup for the instance.
 	// To create a security group to use with multiple images, you can use:
 	// taloscdk.NewSecutiyGroup()
-	// Default: Generates a new security group, opening ports: 6443, 50000, 50001 to the any peer
+	// Default: Generates a new security group, opening port 6443 to any peer. The Talos API (50000, 50001)
+	// is not opened, create the group with SecurityGroupProps.TalosAPIPeers to use talosctl from outside of it
 	SecurityGroup awsec2.SecurityGroup
 
+	// RestrictedEgress creates the default security group with explicit outbound rules. Worker nodes need to reach
+	// the control plane nodes, use the control plane's SecurityGroup, ClusterSecurityGroups or AddClusterPeer().
+	// See ControlPlaneProps.RestrictedEgress.
+	// Default: nil (all outbound traffic is allowed)
+	RestrictedEgress *EgressProps
+
+	// KubeSpan enables KubeSpan and cluster discovery in TalosNodeConfig and opens the WireGuard port in the
+	// default security group, and between it and KubeSpanProps.NodeSecurityGroups. See ControlPlaneProps.KubeSpan.
+	// Default: nil (KubeSpan disabled)
+	KubeSpan *KubeSpanProps
+
+	// DualStack adds IPv6 pod and service CIDRs to TalosNodeConfig and opens the default security group to IPv6.
+	// Use the same DualStackProps as the control plane, and see ControlPlaneProps.DualStack for the subnets.
+	// Default: nil (IPv4 only)
+	DualStack *DualStackProps
+
+	// ClusterSecurityGroups from NewClusterSecurityGroups() replaces SecurityGroup with its Worker group
+	// Default: nil
+	ClusterSecurityGroups *ClusterSecurityGroups
+
 	// Vpc selects the AWS VPC to deploy your instance into.
 	// Vpc is required and stack will panic if not given.
 	// awsec2.NewVpc(), awsec2.Vpc_FromLookup() will return a usable VPC
@@ -186,13 +395,65 @@ type WorkerASGProps struct {
 	// If planning to create AWS load balancers, it's best to use
 	// taloscdk.NewControlPlaneIAMRole() or taloscdk.NewWorkerIAMRole()
 	// Default: NewWorkerIAMRole()
-	IAMRole awsiam.Role
+	IAMRole awsiam.IRole
+
+	// IAMRoleProps configure the default IAMRole (permissions boundary, path, managed policies, name prefix).
+	// Ignored if IAMRole is set.
+	// Default: nil
+	IAMRoleProps *IAMRoleProps
 
 	// DesiredCapacity of the autoscaling group
 	// Best practice: leave it nil. If you set a value, it will always reset the number of
 	// nodes to this number each time you run `cdk deploy`
 	// Default: nil
 	DesiredCapacity *float64 // leave nil if using any autoscaling features, otherwise it will be replaced each `cdk deploy`
+
+	// ConfigDelivery determines how TalosNodeConfig reaches the nodes. See ControlPlaneProps.ConfigDelivery.
+	// Default: ConfigDeliveryUserData
+	ConfigDelivery ConfigDelivery
+
+	// MachineConfigSecret holding the machine config for ConfigDeliveryMaintenanceMode.
+	// Default: a secret is created from TalosNodeConfig with NewMachineConfigSecret()
+	MachineConfigSecret awssecretsmanager.ISecret
+
+	// TalosAPIFunctionSubnets are the subnets for Lambda functions that call the Talos API.
+	// They need a route to AWS APIs, through a NAT gateway or VPC endpoints.
+	// Default: &awsec2.SubnetSelection{SubnetType: awsec2.SubnetType_PRIVATE}
+	TalosAPIFunctionSubnets *awsec2.SubnetSelection
+
+	// TalosconfigSecret is a Secrets Manager secret containing a talosconfig for the cluster.
+	// Required by WaitForReady.
+	// Default: nil
+	TalosconfigSecret awssecretsmanager.ISecret
+
+	// WaitForReady adds a creation policy to the ASG, so the stack only finishes creating once every
+	// node passes ReadinessCheck. See ControlPlaneProps.WaitForReady.
+	// Workers only become ready once the control plane is bootstrapped, consider adding a dependency
+	// on ControlPlane.Bootstrap.
+	// Default: jsii.Bool(false)
+	WaitForReady *bool
+
+	// ReadinessCheck used by WaitForReady.
+	// Default: ReadinessCheckTalos
+	ReadinessCheck ReadinessCheck
+
+	// ReadyTimeout is how long CloudFormation waits for the nodes before failing the stack.
+	// Default: awscdk.Duration_Minutes(jsii.Number(30))
+	ReadyTimeout awscdk.Duration
+
+	// ClusterAutoscaler tags the ASG for discovery by the cluster autoscaler of ClusterName (see
+	// ControlPlaneProps.ClusterAutoscaler). Leave DesiredCapacity nil when the autoscaler manages the group.
+	// Default: nil (static group)
+	ClusterAutoscaler *AutoscaledNodeGroupProps
+
+	// ImageMirror pulls images through ECR. See ControlPlaneProps.ImageMirror.
+	// Default: nil (images are pulled from their registries)
+	ImageMirror *ImageMirror
+
+	// ECRCredentialProvider configures kubelet to pull private ECR images with the IAM role's credentials.
+	// See ControlPlaneProps.ECRCredentialProvider.
+	// Default: nil (no kubelet credential provider)
+	ECRCredentialProvider *ECRCredentialProviderProps
 }
 
 // NewControlPlane creates a new NLB and control plane backed by an autoscaling group
@@ -210,9 +471,16 @@ func NewControlPlane(scope constructs.Construct, id *string, props *ControlPlane
 		props.MachineImageName = jsii.String("talos-v0.11.2-*-amd64")
 	}
 
+	if props.ClusterSecurityGroups != nil {
+		props.SecurityGroup = props.ClusterSecurityGroups.ControlPlane
+	}
+
 	if props.SecurityGroup == nil {
-		props.SecurityGroup = NewSecurityGroup(construct, jsii.String("SG"), &SecurityGroupProps{
-			Vpc: props.Vpc,
+		props.SecurityGroup = NewSecurityGroup(construct, jsii.String("TalosSG"), &SecurityGroupProps{
+			Vpc:              props.Vpc,
+			DualStack:        jsii.Bool(props.DualStack != nil),
+			RestrictedEgress: props.RestrictedEgress,
+			KubeSpan:         props.KubeSpan,
 		})
 	}
 
@@ -225,14 +493,33 @@ func NewControlPlane(scope constructs.Construct, id *string, props *ControlPlane
 	}
 
 	if props.IAMRole == nil {
-		props.IAMRole = NewControlPlaneIAMRole(construct, jsii.String("Role"))
+		if props.ScopedIAMPolicy != nil && *props.ScopedIAMPolicy {
+			props.IAMRole = NewScopedControlPlaneIAMRole(construct, jsii.String("Role"), *props.ClusterName, props.IAMRoleProps)
+		} else {
+			props.IAMRole = NewControlPlaneIAMRole(construct, jsii.String("Role"), props.IAMRoleProps)
+		}
 	}
 
 	nlb := awselbv2.NewNetworkLoadBalancer(construct, jsii.String("CP-NLB"), &awselbv2.NetworkLoadBalancerProps{
-		Vpc:            props.Vpc,
-		InternetFacing: jsii.Bool(true),
+		Vpc:                props.Vpc,
+		InternetFacing:     jsii.Bool(true),
+		CrossZoneEnabled:   props.CrossZoneLoadBalancing,
+		DeletionProtection: props.NLBDeletionProtection,
 	})
 
+	if props.ClusterSecurityGroups != nil {
+		setNLBSecurityGroups(nlb, props.ClusterSecurityGroups.LoadBalancer)
+	}
+
+	if props.DualStack != nil {
+		setNLBDualStack(nlb)
+	}
+
+	var accessLogsBucket awss3.IBucket
+	if props.NLBAccessLogs != nil {
+		accessLogsBucket = enableNLBAccessLogs(construct, nlb, props.NLBAccessLogs)
+	}
+
 	if props.OverwriteValue == nil {
 		props.OverwriteValue = nlb.LoadBalancerDnsName()
 	}
@@ -249,57 +536,220 @@ func NewControlPlane(scope constructs.Construct, id *string, props *ControlPlane
 		props.InternetFacingNLB = jsii.Bool(true)
 	}
 
-	var image awsec2.IMachineImage
+	if props.Topology == "" {
+		props.Topology = ControlPlaneTopologySingleASG
+	}
 
-	if props.MachineImageAMI != nil {
-		image = awsec2.NewGenericLinuxImage(props.MachineImageAMI, &awsec2.GenericLinuxImageProps{
-			UserData: awsec2.UserData_Custom(props.TalosNodeConfig),
-		})
-	} else {
-		image = awsec2.NewLookupMachineImage(&awsec2.LookupMachineImageProps{
-			Name:     props.MachineImageName,
-			Owners:   jsii.Strings("540036508848"),
-			UserData: awsec2.UserData_Custom(props.TalosNodeConfig),
-		})
+	var subnets []awsec2.ISubnet
+	if props.Topology == ControlPlaneTopologyPerAZ {
+		subnets = subnetsPerAZ(props.Vpc, props.SubnetSelection)
+	}
+
+	var enis []awsec2.CfnNetworkInterface
+	if props.StablePrivateIPs != nil && *props.StablePrivateIPs {
+		if props.Topology != ControlPlaneTopologyPerAZ {
+			panic("StablePrivateIPs requires Topology: ControlPlaneTopologyPerAZ")
+		}
+		enis = newStableENIs(construct, subnets, props.SecurityGroup, props.PrivateIPs)
+		if props.DualStack != nil {
+			for _, eni := range enis {
+				eni.SetIpv6AddressCount(jsii.Number(1))
+			}
+		}
+		props.TalosNodeConfig = PatchConfig(props.TalosNodeConfig, stableENIConfigPatch(enis))
+	}
+
+	if props.ClusterAutoscaler != nil {
+		GrantClusterAutoscaler(props.IAMRole, *props.ClusterName)
+
+		if props.ClusterAutoscaler.InlineManifest == nil || *props.ClusterAutoscaler.InlineManifest {
+			manifest := NewClusterAutoscalerManifest(construct, *props.ClusterName, props.ClusterAutoscaler)
+			props.TalosNodeConfig = PatchConfig(props.TalosNodeConfig, inlineManifestPatch("cluster-autoscaler", manifest))
+		}
+	}
+
+	if props.EBSCSIDriver != nil {
+		GrantEBSCSIDriver(props.IAMRole, props.EBSCSIDriver.KMSKey)
+
+		if props.EBSCSIDriver.InlineManifests == nil || *props.EBSCSIDriver.InlineManifests {
+			props.TalosNodeConfig = PatchConfig(props.TalosNodeConfig, inlineManifestPatch("aws-ebs-csi-driver", NewEBSCSIDriverManifest(construct, props.EBSCSIDriver)))
+
+			if props.EBSCSIDriver.DefaultStorageClass == nil || *props.EBSCSIDriver.DefaultStorageClass {
+				props.TalosNodeConfig = PatchConfig(props.TalosNodeConfig, inlineManifestPatch("ebs-gp3-storageclass", NewEBSStorageClassManifest(props.EBSCSIDriver.KMSKey)))
+			}
+		}
+	}
+
+	if props.AWSLoadBalancerController != nil {
+		GrantAWSLoadBalancerController(props.IAMRole)
+
+		if props.AWSLoadBalancerController.InlineManifests != nil && *props.AWSLoadBalancerController.InlineManifests {
+			manifest := NewAWSLoadBalancerControllerManifest(construct, *props.ClusterName, props.Vpc, props.AWSLoadBalancerController)
+			props.TalosNodeConfig = PatchConfig(props.TalosNodeConfig, inlineManifestPatch("aws-load-balancer-controller", manifest))
+			props.TalosNodeConfig = PatchConfig(props.TalosNodeConfig, map[string]interface{}{
+				"cluster": map[string]interface{}{
+					"extraManifests": []interface{}{AWSLoadBalancerControllerCRDsURL(*props.AWSLoadBalancerController.Version)},
+				},
+			})
+		}
+	}
+
+	if props.RestrictedEgress != nil {
+		props.TalosNodeConfig = PatchConfig(props.TalosNodeConfig, RestrictedEgressConfigPatch(props.RestrictedEgress))
+	}
+
+	if props.KubeSpan != nil {
+		requireTalosV1("KubeSpan", props.MachineImageAMI, props.MachineImageName)
+		props.TalosNodeConfig = PatchConfig(props.TalosNodeConfig, KubeSpanConfigPatch(props.KubeSpan))
+	}
+
+	if props.DualStack != nil {
+		props.TalosNodeConfig = PatchConfig(props.TalosNodeConfig, DualStackConfigPatch(props.DualStack))
+	}
+
+	if props.ImageMirror != nil {
+		props.ImageMirror.checkImage(props.MachineImageAMI, props.MachineImageName)
+		props.ImageMirror.AddNodes(props.IAMRole, props.SecurityGroup)
+		props.TalosNodeConfig = PatchConfig(props.TalosNodeConfig, props.ImageMirror.ConfigPatch)
+	}
+
+	if props.ECRCredentialProvider != nil {
+		requireTalosV1("ECRCredentialProvider", props.MachineImageAMI, props.MachineImageName)
+		warnECRCredentialProviderImage(construct, props.ECRCredentialProvider)
+		GrantECRPull(props.IAMRole)
+		props.TalosNodeConfig = PatchConfig(props.TalosNodeConfig, ECRCredentialProviderConfigPatch(props.ECRCredentialProvider))
+	}
+
+	if props.ConfigDelivery == "" {
+		props.ConfigDelivery = ConfigDeliveryUserData
+	}
+
+	userData := props.TalosNodeConfig
+	if props.ConfigDelivery == ConfigDeliveryMaintenanceMode {
+		if props.MachineConfigSecret == nil {
+			props.MachineConfigSecret = NewMachineConfigSecret(construct, jsii.String("MachineConfig"), props.TalosNodeConfig, nil)
+		}
+		userData = jsii.String("")
+	}
+
+	image := newMachineImage(props.MachineImageAMI, props.MachineImageName, userData)
+
+	var signals awsautoscaling.Signals
+	if props.WaitForReady != nil && *props.WaitForReady {
+		if props.ReadinessCheck == ReadinessCheckKubernetes && props.Bootstrap != nil && *props.Bootstrap {
+			panic("ReadinessCheckKubernetes can't be used with Bootstrap, nodes only become Ready after the bootstrap")
+		}
+		signals = readinessSignals(props.ReadyTimeout)
 	}
 
 	TagSubnets(props.Vpc)
 
-	cpAsg := awsautoscaling.NewAutoScalingGroup(construct, jsii.String("TalosCP"), &awsautoscaling.AutoScalingGroupProps{
-		AllowAllOutbound: jsii.Bool(true),
-		DesiredCapacity:  props.DesiredCapacity,
-		MinCapacity:      props.MinInstances,
-		MaxCapacity:      props.MaxInstances,
-		VpcSubnets:       props.SubnetSelection,
-		Vpc:              props.Vpc,
-		InstanceType:     props.InstanceType,
-		MachineImage:     image,
-		Role:             props.IAMRole,
-		SecurityGroup:    props.SecurityGroup,
-	})
+	var asgs []awsautoscaling.AutoScalingGroup
+	switch props.Topology {
+	case ControlPlaneTopologySingleASG:
+		asgs = append(asgs, awsautoscaling.NewAutoScalingGroup(construct, jsii.String("TalosCP"), &awsautoscaling.AutoScalingGroupProps{
+			AllowAllOutbound: jsii.Bool(props.RestrictedEgress == nil),
+			DesiredCapacity:  props.DesiredCapacity,
+			MinCapacity:      props.MinInstances,
+			MaxCapacity:      props.MaxInstances,
+			VpcSubnets:       props.SubnetSelection,
+			Vpc:              props.Vpc,
+			InstanceType:     props.InstanceType,
+			MachineImage:     image,
+			Role:             props.IAMRole,
+			SecurityGroup:    props.SecurityGroup,
+			Signals:          signals,
+		}))
+	case ControlPlaneTopologyPerAZ:
+		if len(subnets)%2 == 0 {
+			awscdk.Annotations_Of(construct).AddWarning(jsii.String(fmt.Sprintf("Control plane spans %d AZs. An odd number of etcd members is recommended to tolerate failures.", len(subnets))))
+		}
+
+		for i, subnet := range subnets {
+			asgs = append(asgs, awsautoscaling.NewAutoScalingGroup(construct, jsii.String(fmt.Sprintf("TalosCP%d", i)), &awsautoscaling.AutoScalingGroupProps{
+				AllowAllOutbound: jsii.Bool(props.RestrictedEgress == nil),
+				MinCapacity:      jsii.Number(1),
+				MaxCapacity:      jsii.Number(1),
+				VpcSubnets:       &awsec2.SubnetSelection{Subnets: &[]awsec2.ISubnet{subnet}},
+				Vpc:              props.Vpc,
+				InstanceType:     props.InstanceType,
+				MachineImage:     image,
+				Role:             props.IAMRole,
+				SecurityGroup:    props.SecurityGroup,
+				Signals:          signals,
+			}))
+		}
+	default:
+		panic(fmt.Sprintf("Unknown control plane topology: %s", props.Topology))
+	}
 
-	targets := awselbv2.NewNetworkTargetGroup(construct, jsii.String("targetgroup-6443"), &awselbv2.NetworkTargetGroupProps{
-		Port: jsii.Number(6443),
-		HealthCheck: &awselbv2.HealthCheck{
-			Enabled:  jsii.Bool(true),
-			Port:     jsii.String("6443"),
-			Protocol: awselbv2.Protocol_TCP,
-		},
-		TargetType: awselbv2.TargetType_INSTANCE,
-		Vpc:        props.Vpc,
-	})
+	targets := newKubernetesAPITargets(construct, nlb, props.Vpc)
+	for _, asg := range asgs {
+		asg.AttachToNetworkTargetGroup(targets)
+	}
 
-	cpAsg.AttachToNetworkTargetGroup(targets)
+	// Launch hooks of the ENI attachment and config delivery share the ASGs' hook lists
+	hooks := launchHooks{}
 
-	nlb.AddListener(jsii.String("talos-cp-listener-6443"), &awselbv2.BaseNetworkListenerProps{
-		Port:                jsii.Number(6443),
-		Protocol:            awselbv2.Protocol_TCP,
-		DefaultTargetGroups: &[]awselbv2.INetworkTargetGroup{targets},
-	})
+	if props.ConfigDelivery == ConfigDeliveryMaintenanceMode {
+		addMaintenanceModeProvisioner(construct, hooks, asgs, props.Vpc, props.TalosAPIFunctionSubnets, props.SecurityGroup, props.MachineConfigSecret)
+	}
+
+	if props.EtcdMemberCleanup != nil && *props.EtcdMemberCleanup {
+		addEtcdMemberCleanup(construct, asgs, props.Vpc, props.TalosAPIFunctionSubnets, props.SecurityGroup, props.TalosconfigSecret)
+	}
+
+	if signals != nil {
+		addReadinessSignals(construct, asgs, &readinessProps{
+			Vpc:         props.Vpc,
+			Subnets:     props.TalosAPIFunctionSubnets,
+			NodeSG:      props.SecurityGroup,
+			Talosconfig: props.TalosconfigSecret,
+			Check:       props.ReadinessCheck,
+		})
+	}
+
+	var bootstrap awscdk.CustomResource
+	if props.Bootstrap != nil && *props.Bootstrap {
+		var names []*string
+		for _, asg := range asgs {
+			names = append(names, asg.AutoScalingGroupName())
+		}
+
+		bootstrap = newBootstrap(construct, &bootstrapProps{
+			Vpc:                   props.Vpc,
+			Subnets:               props.TalosAPIFunctionSubnets,
+			NodeSG:                props.SecurityGroup,
+			Talosconfig:           props.TalosconfigSecret,
+			Timeout:               props.BootstrapTimeout,
+			AutoScalingGroupNames: names,
+			Kubeconfig:            props.KubeconfigSecret,
+		})
+	} else if props.KubeconfigSecret != nil {
+		panic("KubeconfigSecret requires Bootstrap")
+	}
+
+	addSecretOutputs(construct, props.TalosconfigSecret, props.KubeconfigSecret)
+
+	var privateIPs []*string
+	if enis != nil {
+		attachENIsOnLaunch(construct, hooks, asgs, enis, props.Vpc, *props.ClusterName)
+		privateIPs = eniAddresses(enis)
+
+		awscdk.NewCfnOutput(construct, jsii.String("PrivateIPs"), &awscdk.CfnOutputProps{
+			Description: jsii.String("Stable private IPs of the control plane nodes, usable as talosconfig endpoints"),
+			Value:       awscdk.Fn_Join(jsii.String(","), &privateIPs),
+		})
+	}
 
 	awscdk.Tags_Of(construct).Add(jsii.String(fmt.Sprintf("kubernetes.io/cluster/%s", *props.ClusterName)), jsii.String("owned"), &awscdk.TagProps{ApplyToLaunchedInstances: jsii.Bool(true)})
 
-	return ControlPlane{Construct: construct, SecurityGroup: props.SecurityGroup, Vpc: props.Vpc, ASG: cpAsg, NLB: nlb, IAMRole: props.IAMRole}
+	var cpAsg awsautoscaling.AutoScalingGroup
+	if props.Topology == ControlPlaneTopologySingleASG {
+		cpAsg = asgs[0]
+	}
+
+	return ControlPlane{Construct: construct, SecurityGroup: props.SecurityGroup, Vpc: props.Vpc, ASG: cpAsg, ASGs: asgs, NLB: nlb, IAMRole: props.IAMRole, AccessLogsBucket: accessLogsBucket, PrivateIPs: privateIPs, Bootstrap: bootstrap, TalosconfigSecret: props.TalosconfigSecret, KubeconfigSecret: props.KubeconfigSecret}
 }
 
 func NewWorkerASG(scope constructs.Construct, id *string, props *WorkerASGProps) awsautoscaling.AutoScalingGroup {
@@ -317,9 +767,16 @@ func NewWorkerASG(scope constructs.Construct, id *string, props *WorkerASGProps)
 		props.MachineImageName = jsii.String("talos-v0.11.2-*-amd64")
 	}
 
+	if props.ClusterSecurityGroups != nil {
+		props.SecurityGroup = props.ClusterSecurityGroups.Worker
+	}
+
 	if props.SecurityGroup == nil {
-		props.SecurityGroup = NewSecurityGroup(construct, jsii.String("SG"), &SecurityGroupProps{
-			Vpc: props.Vpc,
+		props.SecurityGroup = NewSecurityGroup(construct, jsii.String("TalosSG"), &SecurityGroupProps{
+			Vpc:              props.Vpc,
+			DualStack:        jsii.Bool(props.DualStack != nil),
+			RestrictedEgress: props.RestrictedEgress,
+			KubeSpan:         props.KubeSpan,
 		})
 	}
 
@@ -332,7 +789,7 @@ func NewWorkerASG(scope constructs.Construct, id *string, props *WorkerASGProps)
 	}
 
 	if props.IAMRole == nil {
-		props.IAMRole = NewWorkerIAMRole(construct, jsii.String("Role"))
+		props.IAMRole = NewWorkerIAMRole(construct, jsii.String("Role"), props.IAMRoleProps)
 	}
 
 	nlb := awselbv2.NewNetworkLoadBalancer(construct, jsii.String("CP-NLB"), &awselbv2.NetworkLoadBalancerProps{
@@ -352,23 +809,54 @@ func NewWorkerASG(scope constructs.Construct, id *string, props *WorkerASGProps)
 		props.TalosNodeConfig = TransformConfig(props.TalosNodeConfig, *props.EndpointToOverwrite, *props.OverwriteValue)
 	}
 
-	var image awsec2.IMachineImage
+	if props.RestrictedEgress != nil {
+		props.TalosNodeConfig = PatchConfig(props.TalosNodeConfig, RestrictedEgressConfigPatch(props.RestrictedEgress))
+	}
 
-	if props.MachineImageAMI != nil {
-		image = awsec2.NewGenericLinuxImage(props.MachineImageAMI, &awsec2.GenericLinuxImageProps{
-			UserData: awsec2.UserData_Custom(props.TalosNodeConfig),
-		})
-	} else {
-		image = awsec2.NewLookupMachineImage(&awsec2.LookupMachineImageProps{
-			Name:     props.MachineImageName,
-			Owners:   jsii.Strings("540036508848"),
-			UserData: awsec2.UserData_Custom(props.TalosNodeConfig),
-		})
+	if props.KubeSpan != nil {
+		requireTalosV1("KubeSpan", props.MachineImageAMI, props.MachineImageName)
+		props.TalosNodeConfig = PatchConfig(props.TalosNodeConfig, KubeSpanConfigPatch(props.KubeSpan))
+	}
+
+	if props.DualStack != nil {
+		props.TalosNodeConfig = PatchConfig(props.TalosNodeConfig, DualStackConfigPatch(props.DualStack))
+	}
+
+	if props.ImageMirror != nil {
+		props.ImageMirror.checkImage(props.MachineImageAMI, props.MachineImageName)
+		props.ImageMirror.AddNodes(props.IAMRole, props.SecurityGroup)
+		props.TalosNodeConfig = PatchConfig(props.TalosNodeConfig, props.ImageMirror.ConfigPatch)
 	}
+
+	if props.ECRCredentialProvider != nil {
+		requireTalosV1("ECRCredentialProvider", props.MachineImageAMI, props.MachineImageName)
+		warnECRCredentialProviderImage(construct, props.ECRCredentialProvider)
+		GrantECRPull(props.IAMRole)
+		props.TalosNodeConfig = PatchConfig(props.TalosNodeConfig, ECRCredentialProviderConfigPatch(props.ECRCredentialProvider))
+	}
+
+	if props.ConfigDelivery == "" {
+		props.ConfigDelivery = ConfigDeliveryUserData
+	}
+
+	userData := props.TalosNodeConfig
+	if props.ConfigDelivery == ConfigDeliveryMaintenanceMode {
+		if props.MachineConfigSecret == nil {
+			props.MachineConfigSecret = NewMachineConfigSecret(construct, jsii.String("MachineConfig"), props.TalosNodeConfig, nil)
+		}
+		userData = jsii.String("")
+	}
+
+	image := newMachineImage(props.MachineImageAMI, props.MachineImageName, userData)
 	TagSubnets(props.Vpc)
 
+	var signals awsautoscaling.Signals
+	if props.WaitForReady != nil && *props.WaitForReady {
+		signals = readinessSignals(props.ReadyTimeout)
+	}
+
 	asg := awsautoscaling.NewAutoScalingGroup(construct, jsii.String("WorkerASG"), &awsautoscaling.AutoScalingGroupProps{
-		AllowAllOutbound: jsii.Bool(true),
+		AllowAllOutbound: jsii.Bool(props.RestrictedEgress == nil),
 		DesiredCapacity:  props.DesiredCapacity,
 		MinCapacity:      props.MinInstances,
 		MaxCapacity:      props.MaxInstances,
@@ -378,8 +866,27 @@ func NewWorkerASG(scope constructs.Construct, id *string, props *WorkerASGProps)
 		MachineImage:     image,
 		Role:             props.IAMRole,
 		SecurityGroup:    props.SecurityGroup,
+		Signals:          signals,
 	})
 
+	if props.ConfigDelivery == ConfigDeliveryMaintenanceMode {
+		addMaintenanceModeProvisioner(construct, launchHooks{}, []awsautoscaling.AutoScalingGroup{asg}, props.Vpc, props.TalosAPIFunctionSubnets, props.SecurityGroup, props.MachineConfigSecret)
+	}
+
+	if props.ClusterAutoscaler != nil {
+		tagForClusterAutoscaler(asg, *props.ClusterName, props.ClusterAutoscaler)
+	}
+
+	if signals != nil {
+		addReadinessSignals(construct, []awsautoscaling.AutoScalingGroup{asg}, &readinessProps{
+			Vpc:         props.Vpc,
+			Subnets:     props.TalosAPIFunctionSubnets,
+			NodeSG:      props.SecurityGroup,
+			Talosconfig: props.TalosconfigSecret,
+			Check:       props.ReadinessCheck,
+		})
+	}
+
 	awscdk.Tags_Of(construct).Add(jsii.String(fmt.Sprintf("kubernetes.io/cluster/%s", *props.ClusterName)), jsii.String("owned"), &awscdk.TagProps{ApplyToLaunchedInstances: jsii.Bool(true)})
 
 	return asg
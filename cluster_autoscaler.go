@@ -0,0 +1,294 @@
+package taloscdk
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"text/template"
+
+	"github.com/aws/aws-cdk-go/awscdk"
+	"github.com/aws/aws-cdk-go/awscdk/awsautoscaling"
+	"github.com/aws/aws-cdk-go/awscdk/awsiam"
+	"github.com/aws/constructs-go/constructs/v3"
+	"github.com/aws/jsii-runtime-go"
+)
+
+type ClusterAutoscalerProps struct {
+	// InlineManifest adds the cluster-autoscaler manifests to the control plane config as a Talos
+	// inline manifest, running it on the control plane nodes with the control plane IAM role.
+	// Default: jsii.Bool(true)
+	InlineManifest *bool
+
+	// Image of cluster-autoscaler. Use the release matching your Kubernetes minor version.
+	// Default: registry.k8s.io/autoscaling/cluster-autoscaler:v1.33.0
+	Image *string
+
+	// ExtraArgs are appended to the cluster-autoscaler command, e.g. "--scale-down-unneeded-time=5m"
+	// Default: nil
+	ExtraArgs []string
+}
+
+type AutoscaledNodeGroupProps struct {
+	// NodeLabels of the group's nodes, advertised to the cluster autoscaler with
+	// k8s.io/cluster-autoscaler/node-template/label/<key> tags so it can scale the group up from zero.
+	// They have to match the labels set in the worker config (machine.nodeLabels).
+	// Default: nil
+	NodeLabels map[string]string
+
+	// NodeTaints of the group's nodes as key: "value:Effect", advertised with
+	// k8s.io/cluster-autoscaler/node-template/taint/<key> tags.
+	// They have to match the taints set in the worker config (machine.nodeTaints).
+	// Default: nil
+	NodeTaints map[string]string
+}
+
+// clusterAutoscalerManifest is based on the upstream cluster-autoscaler-autodiscover.yaml example
+var clusterAutoscalerManifest = template.Must(template.New("cluster-autoscaler").Parse(`apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: cluster-autoscaler
+  namespace: kube-system
+  labels:
+    k8s-addon: cluster-autoscaler.addons.k8s.io
+    k8s-app: cluster-autoscaler
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: cluster-autoscaler
+  labels:
+    k8s-addon: cluster-autoscaler.addons.k8s.io
+    k8s-app: cluster-autoscaler
+rules:
+  - apiGroups: [""]
+    resources: ["events", "endpoints"]
+    verbs: ["create", "patch"]
+  - apiGroups: [""]
+    resources: ["pods/eviction"]
+    verbs: ["create"]
+  - apiGroups: [""]
+    resources: ["pods/status"]
+    verbs: ["update"]
+  - apiGroups: [""]
+    resources: ["endpoints"]
+    resourceNames: ["cluster-autoscaler"]
+    verbs: ["get", "update"]
+  - apiGroups: [""]
+    resources: ["nodes"]
+    verbs: ["watch", "list", "get", "update"]
+  - apiGroups: [""]
+    resources: ["namespaces", "pods", "services", "replicationcontrollers", "persistentvolumeclaims", "persistentvolumes"]
+    verbs: ["watch", "list", "get"]
+  - apiGroups: ["extensions"]
+    resources: ["replicasets", "daemonsets"]
+    verbs: ["watch", "list", "get"]
+  - apiGroups: ["policy"]
+    resources: ["poddisruptionbudgets"]
+    verbs: ["watch", "list"]
+  - apiGroups: ["apps"]
+    resources: ["statefulsets", "replicasets", "daemonsets"]
+    verbs: ["watch", "list", "get"]
+  - apiGroups: ["storage.k8s.io"]
+    resources: ["storageclasses", "csinodes", "csidrivers", "csistoragecapacities", "volumeattachments"]
+    verbs: ["watch", "list", "get"]
+  - apiGroups: ["batch", "extensions"]
+    resources: ["jobs"]
+    verbs: ["get", "list", "watch", "patch"]
+  - apiGroups: ["coordination.k8s.io"]
+    resources: ["leases"]
+    verbs: ["create"]
+  - apiGroups: ["coordination.k8s.io"]
+    resourceNames: ["cluster-autoscaler"]
+    resources: ["leases"]
+    verbs: ["get", "update"]
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: Role
+metadata:
+  name: cluster-autoscaler
+  namespace: kube-system
+  labels:
+    k8s-addon: cluster-autoscaler.addons.k8s.io
+    k8s-app: cluster-autoscaler
+rules:
+  - apiGroups: [""]
+    resources: ["configmaps"]
+    verbs: ["create", "list", "watch"]
+  - apiGroups: [""]
+    resources: ["configmaps"]
+    resourceNames: ["cluster-autoscaler-status", "cluster-autoscaler-priority-expander"]
+    verbs: ["delete", "get", "update", "watch"]
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: cluster-autoscaler
+  labels:
+    k8s-addon: cluster-autoscaler.addons.k8s.io
+    k8s-app: cluster-autoscaler
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: cluster-autoscaler
+subjects:
+  - kind: ServiceAccount
+    name: cluster-autoscaler
+    namespace: kube-system
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: cluster-autoscaler
+  namespace: kube-system
+  labels:
+    k8s-addon: cluster-autoscaler.addons.k8s.io
+    k8s-app: cluster-autoscaler
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: Role
+  name: cluster-autoscaler
+subjects:
+  - kind: ServiceAccount
+    name: cluster-autoscaler
+    namespace: kube-system
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: cluster-autoscaler
+  namespace: kube-system
+  labels:
+    app: cluster-autoscaler
+spec:
+  replicas: 1
+  selector:
+    matchLabels:
+      app: cluster-autoscaler
+  template:
+    metadata:
+      labels:
+        app: cluster-autoscaler
+    spec:
+      priorityClassName: system-cluster-critical
+      serviceAccountName: cluster-autoscaler
+      securityContext:
+        runAsNonRoot: true
+        runAsUser: 65534
+        fsGroup: 65534
+        seccompProfile:
+          type: RuntimeDefault
+      # Runs on the control plane to use its instance profile
+      nodeSelector:
+        node-role.kubernetes.io/control-plane: ""
+      tolerations:
+        - key: node-role.kubernetes.io/control-plane
+          operator: Exists
+          effect: NoSchedule
+      containers:
+        - name: cluster-autoscaler
+          image: {{ .Image }}
+          resources:
+            limits:
+              cpu: 100m
+              memory: 600Mi
+            requests:
+              cpu: 100m
+              memory: 600Mi
+          command:
+            - ./cluster-autoscaler
+            - --v=4
+            - --stderrthreshold=info
+            - --cloud-provider=aws
+            - --skip-nodes-with-local-storage=false
+            - --expander=least-waste
+            - --node-group-auto-discovery=asg:tag=k8s.io/cluster-autoscaler/enabled,k8s.io/cluster-autoscaler/{{ .ClusterName }}
+{{- range .ExtraArgs }}
+            - {{ . }}
+{{- end }}
+          env:
+            - name: AWS_REGION
+              value: {{ .Region }}
+          volumeMounts:
+            - name: ssl-certs
+              mountPath: /etc/ssl/certs/ca-certificates.crt
+              readOnly: true
+          imagePullPolicy: Always
+          securityContext:
+            allowPrivilegeEscalation: false
+            capabilities:
+              drop:
+                - ALL
+            readOnlyRootFilesystem: true
+      volumes:
+        - name: ssl-certs
+          hostPath:
+            path: /etc/ssl/certs/ca-certificates.crt
+`))
+
+// NewClusterAutoscalerManifest returns the cluster-autoscaler manifests, discovering the worker ASGs
+// of clusterName that were created with WorkerASGProps.ClusterAutoscaler.
+func NewClusterAutoscalerManifest(scope constructs.Construct, clusterName string, props *ClusterAutoscalerProps) *string {
+	if props == nil {
+		props = &ClusterAutoscalerProps{}
+	}
+
+	if props.Image == nil {
+		props.Image = jsii.String("registry.k8s.io/autoscaling/cluster-autoscaler:v1.33.0")
+	}
+
+	var manifest bytes.Buffer
+	err := clusterAutoscalerManifest.Execute(&manifest, map[string]interface{}{
+		"ClusterName": clusterName,
+		"Image":       *props.Image,
+		"ExtraArgs":   props.ExtraArgs,
+		"Region":      *awscdk.Stack_Of(scope).Region(),
+	})
+	if err != nil {
+		panic(fmt.Sprintf("Could not render cluster-autoscaler manifest: %v", err))
+	}
+
+	return jsii.String(manifest.String())
+}
+
+// GrantClusterAutoscaler allows role to run the cluster autoscaler, see ClusterAutoscalerPolicyModule()
+func GrantClusterAutoscaler(role awsiam.IRole, clusterName string) {
+	NewIAMPolicyBuilder(ClusterAutoscalerPolicyModule(clusterName)).Grant(role)
+}
+
+// tagForClusterAutoscaler adds the auto-discovery and node template tags to asg
+func tagForClusterAutoscaler(asg awsautoscaling.AutoScalingGroup, clusterName string, props *AutoscaledNodeGroupProps) {
+	tags := map[string]string{
+		"k8s.io/cluster-autoscaler/enabled":                      "true",
+		fmt.Sprintf("k8s.io/cluster-autoscaler/%s", clusterName): "owned",
+	}
+
+	for key, value := range props.NodeLabels {
+		tags["k8s.io/cluster-autoscaler/node-template/label/"+key] = value
+	}
+
+	for key, value := range props.NodeTaints {
+		tags["k8s.io/cluster-autoscaler/node-template/taint/"+key] = value
+	}
+
+	// Sorted, so the template doesn't change between synths
+	var keys []string
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		awscdk.Tags_Of(asg).Add(jsii.String(key), jsii.String(tags[key]), &awscdk.TagProps{ApplyToLaunchedInstances: jsii.Bool(false)})
+	}
+}
+
+// inlineManifestPatch adds a Talos inline manifest to a control plane config
+func inlineManifestPatch(name string, contents *string) map[string]interface{} {
+	return map[string]interface{}{
+		"cluster": map[string]interface{}{
+			"inlineManifests": []interface{}{
+				map[string]interface{}{"name": name, "contents": *contents},
+			},
+		},
+	}
+}
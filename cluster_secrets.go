@@ -0,0 +1,128 @@
+package taloscdk
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-cdk-go/awscdk"
+	"github.com/aws/aws-cdk-go/awscdk/awsiam"
+	"github.com/aws/aws-cdk-go/awscdk/awskms"
+	"github.com/aws/aws-cdk-go/awscdk/awssecretsmanager"
+	"github.com/aws/constructs-go/constructs/v3"
+	"github.com/aws/jsii-runtime-go"
+)
+
+type ClusterSecretsProps struct {
+	// ClusterName is used for naming the secrets talos/<ClusterName>/talosconfig and talos/<ClusterName>/kubeconfig
+	// Default: talos
+	ClusterName *string
+
+	// Talosconfig is a *string of the talosconfig you've generated with `talosctl gen config`.
+	// It is stored as part of the CloudFormation template, like the machine configs.
+	// Talosconfig is required
+	Talosconfig *string
+
+	// EncryptionKey for both secrets.
+	// Default: a new KMS key with key rotation enabled
+	EncryptionKey awskms.IKey
+
+	// ReadPrincipals are allowed to read both secrets. They are named in the secrets' resource policies
+	// and granted decrypt on the key, so principals from other accounts (e.g. CI) can use them as well.
+	// Default: nil (only principals granted access through IAM)
+	ReadPrincipals []awsiam.IPrincipal
+}
+
+type ClusterSecrets struct {
+	constructs.Construct
+	EncryptionKey awskms.IKey
+
+	// Talosconfig secret, pass it as TalosconfigSecret to ControlPlane or SingleNode
+	Talosconfig awssecretsmanager.ISecret
+
+	// Kubeconfig secret, pass it as KubeconfigSecret to ControlPlane or SingleNode so Bootstrap fills it
+	// with the admin kubeconfig. Until then, it holds a random placeholder.
+	Kubeconfig awssecretsmanager.ISecret
+}
+
+// NewClusterSecrets creates KMS-encrypted Secrets Manager secrets for the cluster's talosconfig and
+// admin kubeconfig, so credentials don't live only on the laptop that created the cluster.
+// Required ClusterSecretsProps: Talosconfig
+func NewClusterSecrets(scope constructs.Construct, id *string, props *ClusterSecretsProps) ClusterSecrets {
+	construct := awscdk.NewConstruct(scope, jsii.String(*id))
+
+	if props.ClusterName == nil {
+		props.ClusterName = jsii.String("talos")
+	}
+
+	if props.Talosconfig == nil {
+		panic("Talosconfig cannot be nil. taloscdk.LoadConfig() can be used to load the needed file.")
+	}
+
+	if props.EncryptionKey == nil {
+		props.EncryptionKey = awskms.NewKey(construct, jsii.String("Key"), &awskms.KeyProps{
+			Description:       jsii.String(fmt.Sprintf("Talos cluster %s credentials", *props.ClusterName)),
+			EnableKeyRotation: jsii.Bool(true),
+		})
+	}
+
+	talosconfig := newEncryptedSecret(construct, jsii.String("Talosconfig"), &awssecretsmanager.CfnSecretProps{
+		Name:         jsii.String(fmt.Sprintf("talos/%s/talosconfig", *props.ClusterName)),
+		Description:  jsii.String("Talos client config (talosconfig)"),
+		SecretString: props.Talosconfig,
+	}, props)
+
+	kubeconfig := newEncryptedSecret(construct, jsii.String("Kubeconfig"), &awssecretsmanager.CfnSecretProps{
+		Name:                 jsii.String(fmt.Sprintf("talos/%s/kubeconfig", *props.ClusterName)),
+		Description:          jsii.String("Kubernetes admin kubeconfig, written by the Talos bootstrap"),
+		GenerateSecretString: &awssecretsmanager.CfnSecret_GenerateSecretStringProperty{},
+	}, props)
+
+	for _, principal := range props.ReadPrincipals {
+		props.EncryptionKey.GrantDecrypt(principal)
+	}
+
+	return ClusterSecrets{Construct: construct, EncryptionKey: props.EncryptionKey, Talosconfig: talosconfig, Kubeconfig: kubeconfig}
+}
+
+// newEncryptedSecret creates a secret encrypted with the EncryptionKey and readable by the ReadPrincipals of props
+func newEncryptedSecret(scope awscdk.Construct, id *string, secretProps *awssecretsmanager.CfnSecretProps, props *ClusterSecretsProps) awssecretsmanager.ISecret {
+	secretProps.KmsKeyId = props.EncryptionKey.KeyArn()
+
+	cfnSecret := awssecretsmanager.NewCfnSecret(scope, id, secretProps)
+
+	secret := awssecretsmanager.Secret_FromSecretAttributes(scope, jsii.String(*id+"Ref"), &awssecretsmanager.SecretAttributes{
+		SecretCompleteArn: cfnSecret.Ref(),
+		EncryptionKey:     props.EncryptionKey,
+	})
+
+	if props.ReadPrincipals != nil {
+		policy := awssecretsmanager.NewResourcePolicy(scope, jsii.String(*id+"Policy"), &awssecretsmanager.ResourcePolicyProps{Secret: secret})
+		policy.Document().AddStatements(awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
+			Effect: awsiam.Effect_ALLOW,
+			Actions: jsii.Strings(
+				"secretsmanager:GetSecretValue",
+				"secretsmanager:DescribeSecret",
+			),
+			Principals: &props.ReadPrincipals,
+			Resources:  jsii.Strings("*"),
+		}))
+	}
+
+	return secret
+}
+
+// addSecretOutputs exports the ARNs of the talosconfig and kubeconfig secrets (if any) for pipelines
+func addSecretOutputs(scope awscdk.Construct, talosconfig awssecretsmanager.ISecret, kubeconfig awssecretsmanager.ISecret) {
+	if talosconfig != nil {
+		awscdk.NewCfnOutput(scope, jsii.String("TalosconfigSecretArn"), &awscdk.CfnOutputProps{
+			Description: jsii.String("ARN of the Secrets Manager secret holding the talosconfig"),
+			Value:       talosconfig.SecretArn(),
+		})
+	}
+
+	if kubeconfig != nil {
+		awscdk.NewCfnOutput(scope, jsii.String("KubeconfigSecretArn"), &awscdk.CfnOutputProps{
+			Description: jsii.String("ARN of the Secrets Manager secret holding the admin kubeconfig"),
+			Value:       kubeconfig.SecretArn(),
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package taloscdk
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-cdk-go/awscdk"
+	"github.com/aws/aws-cdk-go/awscdk/awsec2"
+	"github.com/aws/constructs-go/constructs/v3"
+	"github.com/aws/jsii-runtime-go"
+)
+
+type ClusterSecurityGroupsProps struct {
+	// Required.
+	Vpc awsec2.IVpc
+
+	// ClusterName is used for tagging the node groups with kubernetes.io/cluster/<name>=owned, so the
+	// cloud controller can add load balancer rules to them
+	// Default: talos
+	ClusterName *string
+
+	// AllowTrafficFrom is a peer to allow ingress to both the Kubernetes and Talos APIs.
+	// Deprecated: use KubernetesAPIPeers and TalosAPIPeers. If set, it's added to both.
+	// Default: nil
+	AllowTrafficFrom awsec2.IPeer
+
+	// KubernetesAPIPeers may reach the Kubernetes API through the NLB. Peers can be CIDRs (awsec2.Peer_Ipv4()),
+	// managed prefix lists (awsec2.Peer_PrefixList()) or security groups.
+	// The node groups are always admitted, which covers nodes reaching an internal NLB. Nodes reach an
+	// internet-facing NLB from their public IPs or the NAT gateway EIPs instead, so add those CIDRs when
+	// replacing the default, or the nodes can't reach the cluster endpoint.
+	// Default: awsec2.Peer_AnyIpv4 (unless AllowTrafficFrom is set)
+	KubernetesAPIPeers []awsec2.IPeer
+
+	// TalosAPIPeers may reach the Talos API of the control plane nodes, which proxy requests to workers
+	// Default: nil (only nodes and Lambda-backed features)
+	TalosAPIPeers []awsec2.IPeer
+
+	// PublicTalosAPI allows the Talos API of the control plane from anywhere (0.0.0.0/0) in addition to TalosAPIPeers
+	// Default: jsii.Bool(false)
+	PublicTalosAPI *bool
+
+	// RestrictedEgress replaces allow all outbound of the node groups with explicit rules for what Talos needs,
+	// and all traffic between nodes. Patch the node configs with RestrictedEgressConfigPatch().
+	// Default: nil (all outbound traffic is allowed)
+	RestrictedEgress *EgressProps
+
+	// KubeSpan opens the KubeSpan WireGuard port (UDP 51820) between all nodes and to KubeSpanProps.Peers.
+	// Patch the node configs with KubeSpanConfigPatch().
+	// Default: nil
+	KubeSpan *KubeSpanProps
+
+	// DualStack adds IPv6 rules (::/0) next to the IPv4 defaults of KubernetesAPIPeers and PublicTalosAPI,
+	// and to the outbound rules of the node groups unless RestrictedEgress is set.
+	// Traffic between the groups is allowed for both address families.
+	// Default: jsii.Bool(false)
+	DualStack *bool
+
+	// CNIPorts are opened between all nodes for the pod network
+	// Default: UDP 8472 (VXLAN, used by Flannel, the default Talos CNI, and Cilium)
+	CNIPorts []awsec2.Port
+
+	// NodePortPeers may reach the NodePort range (30000-32767) of workers, in addition to the NLB-facing group
+	// Default: the VPC CIDR (load balancers created for Services, their health checks and internal clients)
+	NodePortPeers []awsec2.IPeer
+}
+
+type ClusterSecurityGroups struct {
+	constructs.Construct
+
+	// ControlPlane nodes: Kubernetes API, Talos API, etcd between control plane nodes
+	ControlPlane awsec2.SecurityGroup
+
+	// Worker nodes: kubelet, Talos API from the control plane, NodePorts
+	Worker awsec2.SecurityGroup
+
+	// LoadBalancer is attached to the control plane NLB and only allows the Kubernetes API from
+	// KubernetesAPIPeers and the nodes
+	LoadBalancer awsec2.SecurityGroup
+}
+
+// NewClusterSecurityGroups returns separate security groups for control plane nodes, workers and the control plane NLB,
+// referencing each other so that only the ports Talos and Kubernetes need are open between them:
+//   - Kubernetes API (6443) on the NLB from KubernetesAPIPeers and all nodes, on the control plane from the NLB,
+//     other control plane nodes and workers
+//   - Talos API (50000) on the control plane from TalosAPIPeers and on workers from the control plane (apid proxies requests)
+//   - trustd (50001) on the control plane from all nodes
+//   - etcd (2379-2380) between control plane nodes
+//   - kubelet (10250) and CNIPorts between all nodes
+//   - NodePorts (30000-32767) on workers from the NLB-facing group and NodePortPeers
+//   - KubeSpan (51820/udp) between all nodes, if enabled
+//
+// Use them with ControlPlaneProps.ClusterSecurityGroups and WorkerASGProps.ClusterSecurityGroups.
+// Requires a Vpc in the *ClusterSecurityGroupsProps
+func NewClusterSecurityGroups(scope constructs.Construct, id *string, props *ClusterSecurityGroupsProps) ClusterSecurityGroups {
+	construct := awscdk.NewConstruct(scope, jsii.String(*id))
+
+	if props == nil {
+		props = &ClusterSecurityGroupsProps{}
+	}
+
+	if props.Vpc == nil {
+		panic("NewClusterSecurityGroups() requires a Vpc in ClusterSecurityGroupsProps")
+	}
+
+	if props.ClusterName == nil {
+		props.ClusterName = jsii.String("talos")
+	}
+
+	if props.NodePortPeers == nil {
+		props.NodePortPeers = []awsec2.IPeer{awsec2.Peer_Ipv4(props.Vpc.VpcCidrBlock())}
+	}
+
+	if props.CNIPorts == nil {
+		props.CNIPorts = []awsec2.Port{awsec2.Port_Udp(jsii.Number(8472))}
+	}
+
+	cp := awsec2.NewSecurityGroup(construct, jsii.String("ControlPlane"), &awsec2.SecurityGroupProps{
+		Vpc:              props.Vpc,
+		AllowAllOutbound: jsii.Bool(props.RestrictedEgress == nil),
+		Description:      jsii.String("Talos control plane nodes"),
+	})
+
+	worker := awsec2.NewSecurityGroup(construct, jsii.String("Worker"), &awsec2.SecurityGroupProps{
+		Vpc:              props.Vpc,
+		AllowAllOutbound: jsii.Bool(props.RestrictedEgress == nil),
+		Description:      jsii.String("Talos worker nodes"),
+	})
+
+	// Egress of the NLB-facing group is added with the rules it's referenced by
+	lb := awsec2.NewSecurityGroup(construct, jsii.String("LoadBalancer"), &awsec2.SecurityGroupProps{
+		Vpc:              props.Vpc,
+		AllowAllOutbound: jsii.Bool(false),
+		Description:      jsii.String("Talos control plane NLB"),
+	})
+
+	kubernetesAPIPeers, talosAPIPeers := apiPeers(props.AllowTrafficFrom, props.KubernetesAPIPeers, props.TalosAPIPeers, props.PublicTalosAPI, props.DualStack)
+
+	apiServer := awsec2.Port_Tcp(jsii.Number(6443))
+	for _, peer := range kubernetesAPIPeers {
+		lb.AddIngressRule(peer, apiServer, jsii.String("Kubernetes API"), jsii.Bool(false))
+	}
+	lb.AddIngressRule(cp, apiServer, jsii.String("Kubernetes API from control plane"), jsii.Bool(false))
+	lb.AddIngressRule(worker, apiServer, jsii.String("Kubernetes API from workers"), jsii.Bool(false))
+	cp.Connections().AllowFrom(lb, apiServer, jsii.String("Kubernetes API from NLB"))
+	cp.AddIngressRule(cp, apiServer, jsii.String("Kubernetes API from control plane"), jsii.Bool(false))
+	cp.AddIngressRule(worker, apiServer, jsii.String("Kubernetes API from workers"), jsii.Bool(false))
+
+	apid := awsec2.Port_Tcp(jsii.Number(50000))
+	for _, peer := range talosAPIPeers {
+		cp.AddIngressRule(peer, apid, jsii.String("Talos API"), jsii.Bool(false))
+	}
+	cp.AddIngressRule(cp, apid, jsii.String("Talos API from control plane"), jsii.Bool(false))
+	worker.AddIngressRule(cp, apid, jsii.String("Talos API from control plane"), jsii.Bool(false))
+
+	trustd := awsec2.Port_Tcp(jsii.Number(50001))
+	cp.AddIngressRule(cp, trustd, jsii.String("trustd from control plane"), jsii.Bool(false))
+	cp.AddIngressRule(worker, trustd, jsii.String("trustd from workers"), jsii.Bool(false))
+
+	cp.AddIngressRule(cp, awsec2.Port_TcpRange(jsii.Number(2379), jsii.Number(2380)), jsii.String("etcd from control plane"), jsii.Bool(false))
+
+	kubelet := awsec2.Port_Tcp(jsii.Number(10250))
+	for _, sg := range []awsec2.SecurityGroup{cp, worker} {
+		sg.AddIngressRule(cp, kubelet, jsii.String("kubelet from control plane"), jsii.Bool(false))
+		sg.AddIngressRule(worker, kubelet, jsii.String("kubelet from workers"), jsii.Bool(false))
+
+		for _, port := range props.CNIPorts {
+			sg.AddIngressRule(cp, port, jsii.String(fmt.Sprintf("CNI %s from control plane", *port.ToString())), jsii.Bool(false))
+			sg.AddIngressRule(worker, port, jsii.String(fmt.Sprintf("CNI %s from workers", *port.ToString())), jsii.Bool(false))
+		}
+	}
+
+	nodePorts := awsec2.Port_TcpRange(jsii.Number(30000), jsii.Number(32767))
+	worker.Connections().AllowFrom(lb, nodePorts, jsii.String("NodePorts from NLB"))
+	for _, peer := range props.NodePortPeers {
+		worker.AddIngressRule(peer, nodePorts, jsii.String("NodePorts"), jsii.Bool(false))
+	}
+
+	if props.RestrictedEgress != nil {
+		addEgressRules(cp, props.Vpc, props.RestrictedEgress, cp, worker)
+		addEgressRules(worker, props.Vpc, props.RestrictedEgress, cp, worker)
+	} else if props.DualStack != nil && *props.DualStack {
+		allowAllIpv6Outbound(cp)
+		allowAllIpv6Outbound(worker)
+	}
+
+	if props.KubeSpan != nil {
+		addKubeSpanRules(cp, props.KubeSpan, cp, worker)
+		addKubeSpanRules(worker, props.KubeSpan, cp, worker)
+	}
+
+	for _, sg := range []awsec2.SecurityGroup{cp, worker} {
+		awscdk.Tags_Of(sg).Add(jsii.String(fmt.Sprintf("kubernetes.io/cluster/%s", *props.ClusterName)), jsii.String("owned"), nil)
+	}
+
+	return ClusterSecurityGroups{Construct: construct, ControlPlane: cp, Worker: worker, LoadBalancer: lb}
+}
@@ -0,0 +1,64 @@
+package taloscdk
+
+import (
+	"github.com/aws/aws-cdk-go/awscdk"
+	"github.com/aws/aws-cdk-go/awscdk/awsautoscaling"
+	"github.com/aws/aws-cdk-go/awscdk/awsec2"
+	"github.com/aws/aws-cdk-go/awscdk/awsiam"
+	"github.com/aws/aws-cdk-go/awscdk/awskms"
+	"github.com/aws/aws-cdk-go/awscdk/awssecretsmanager"
+	"github.com/aws/jsii-runtime-go"
+)
+
+// ConfigDelivery determines how machine configs reach the nodes of an autoscaling group
+type ConfigDelivery string
+
+const (
+	// ConfigDeliveryUserData passes the machine config as EC2 user data
+	ConfigDeliveryUserData ConfigDelivery = "user-data"
+
+	// ConfigDeliveryMaintenanceMode boots nodes with empty user data into Talos maintenance mode.
+	// A launch lifecycle hook triggers a Lambda that reads the config from Secrets Manager and applies
+	// it through the maintenance API, keeping CA keys out of EC2 instance attributes.
+	ConfigDeliveryMaintenanceMode ConfigDelivery = "maintenance-mode"
+)
+
+// NewMachineConfigSecret stores a machine config in Secrets Manager, for use with ConfigDeliveryMaintenanceMode.
+// The config is still part of the CloudFormation template. To keep it out of the template entirely,
+// create the secret outside of CDK and import it with awssecretsmanager.Secret_FromSecretCompleteArn().
+// The secret is encrypted with key, e.g. the EncryptionKey of NewClusterSecrets(), or the AWS managed key if nil.
+func NewMachineConfigSecret(scope awscdk.Construct, id *string, config *string, key awskms.IKey) awssecretsmanager.ISecret {
+	secretProps := &awssecretsmanager.CfnSecretProps{
+		Description:  jsii.String("Talos machine config"),
+		SecretString: config,
+	}
+	if key != nil {
+		secretProps.KmsKeyId = key.KeyArn()
+	}
+
+	secret := awssecretsmanager.NewCfnSecret(scope, id, secretProps)
+
+	return awssecretsmanager.Secret_FromSecretAttributes(scope, jsii.String(*id+"Ref"), &awssecretsmanager.SecretAttributes{
+		SecretCompleteArn: secret.Ref(),
+		EncryptionKey:     key,
+	})
+}
+
+// addMaintenanceModeProvisioner adds a launch lifecycle hook to each ASG that applies the config
+// stored in secret to new instances through the Talos maintenance API.
+func addMaintenanceModeProvisioner(scope awscdk.Construct, hooks launchHooks, asgs []awsautoscaling.AutoScalingGroup, vpc awsec2.IVpc, subnets *awsec2.SubnetSelection, nodeSG awsec2.SecurityGroup, secret awssecretsmanager.ISecret) {
+	fn := newTalosAPIFunction(scope, jsii.String("ProvisionerFunction"), "provisioner", vpc, subnets, nodeSG, nil, nil, nil)
+	fn.AddToRolePolicy(awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
+		Effect:    awsiam.Effect_ALLOW,
+		Actions:   jsii.Strings("ec2:DescribeInstances"),
+		Resources: jsii.Strings("*"),
+	}))
+	secret.GrantRead(fn, nil)
+
+	target := newLaunchHookTarget(scope, jsii.String("ProvisionerHooks"), fn, hooks)
+
+	for _, asg := range asgs {
+		target.add(asg, "ApplyConfig", awscdk.Fn_Sub(jsii.String(`{"configSecretArn":"${Secret}"}`), &map[string]*string{"Secret": secret.SecretArn()}),
+			awscdk.Duration_Minutes(jsii.Number(10)), awsautoscaling.DefaultResult_ABANDON)
+	}
+}
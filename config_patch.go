@@ -0,0 +1,119 @@
+package taloscdk
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/aws/jsii-runtime-go"
+	"gopkg.in/yaml.v3"
+)
+
+// PatchConfig merges patch into the first document of a Talos machine config, following Talos'
+// strategic merge rules: maps are merged key by key, lists are appended and scalars are replaced.
+// Values may contain CDK tokens (e.g. nlb.LoadBalancerDnsName()), they are kept as-is.
+//
+// Example:
+//
+//	config = taloscdk.PatchConfig(config, map[string]interface{}{
+//		"machine": map[string]interface{}{
+//			"kubelet": map[string]interface{}{"registerWithFQDN": true},
+//		},
+//	})
+func PatchConfig(config *string, patch map[string]interface{}) *string {
+	var node yaml.Node
+	if err := node.Encode(patch); err != nil {
+		panic(fmt.Sprintf("Could not encode config patch: %v", err))
+	}
+
+	return patchConfigNode(config, &node)
+}
+
+// PatchConfigYAML is the same as PatchConfig, but takes the patch as a YAML document
+func PatchConfigYAML(config *string, patch string) *string {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(patch), &doc); err != nil {
+		panic(fmt.Sprintf("Could not parse config patch: %v", err))
+	}
+
+	if len(doc.Content) == 0 {
+		return config
+	}
+
+	return patchConfigNode(config, doc.Content[0])
+}
+
+func patchConfigNode(config *string, patch *yaml.Node) *string {
+	if config == nil {
+		panic("Cannot patch a nil config. taloscdk.LoadConfig() can be used to load the needed file.")
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewBufferString(*config))
+
+	var docs []*yaml.Node
+	for {
+		var doc yaml.Node
+		err := decoder.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			panic(fmt.Sprintf("Could not parse Talos config: %v", err))
+		}
+		docs = append(docs, &doc)
+	}
+
+	if len(docs) == 0 {
+		panic("Cannot patch an empty Talos config")
+	}
+
+	mergeNodes(docs[0].Content[0], patch)
+
+	var out bytes.Buffer
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(4)
+	for _, doc := range docs {
+		if err := encoder.Encode(doc); err != nil {
+			panic(fmt.Sprintf("Could not encode Talos config: %v", err))
+		}
+	}
+	encoder.Close()
+
+	return jsii.String(out.String())
+}
+
+// mergeNodes merges src into dst in place
+func mergeNodes(dst *yaml.Node, src *yaml.Node) {
+	switch {
+	case dst.Kind == yaml.MappingNode && src.Kind == yaml.MappingNode:
+		// talosctl writes empty sections as {}, switch to block style once they have content
+		dst.Style &^= yaml.FlowStyle
+		for i := 0; i < len(src.Content); i += 2 {
+			key, value := src.Content[i], src.Content[i+1]
+
+			existing := mappingValue(dst, key.Value)
+			if existing == nil {
+				dst.Content = append(dst.Content, key, value)
+				continue
+			}
+
+			mergeNodes(existing, value)
+		}
+	case dst.Kind == yaml.SequenceNode && src.Kind == yaml.SequenceNode:
+		dst.Style &^= yaml.FlowStyle
+		dst.Content = append(dst.Content, src.Content...)
+	default:
+		*dst = *src
+	}
+}
+
+// mappingValue returns the value for key in a mapping node, or nil if missing
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	for i := 0; i < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
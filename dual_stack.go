@@ -0,0 +1,73 @@
+package taloscdk
+
+import (
+	"github.com/aws/aws-cdk-go/awscdk/awsec2"
+	"github.com/aws/jsii-runtime-go"
+)
+
+type DualStackProps struct {
+	// PodSubnet is the IPv6 CIDR added to cluster.network.podSubnets. Each node gets a /64 of it.
+	// Default: fd00:10:244::/56
+	PodSubnet *string
+
+	// ServiceSubnet is the IPv6 CIDR added to cluster.network.serviceSubnets, at most a /108
+	// Default: fd00:10:96::/112
+	ServiceSubnet *string
+}
+
+// DualStackConfigPatch returns a config patch that adds IPv6 pod and service CIDRs to the cluster network.
+// IPv4 stays the primary family, as long as the config already has IPv4 CIDRs (talosctl gen config adds them).
+func DualStackConfigPatch(props *DualStackProps) map[string]interface{} {
+	if props == nil {
+		props = &DualStackProps{}
+	}
+
+	if props.PodSubnet == nil {
+		props.PodSubnet = jsii.String("fd00:10:244::/56")
+	}
+
+	if props.ServiceSubnet == nil {
+		props.ServiceSubnet = jsii.String("fd00:10:96::/112")
+	}
+
+	return map[string]interface{}{
+		"cluster": map[string]interface{}{
+			"network": map[string]interface{}{
+				"podSubnets":     []interface{}{*props.PodSubnet},
+				"serviceSubnets": []interface{}{*props.ServiceSubnet},
+			},
+		},
+	}
+}
+
+// AssignIpv6Addresses makes the selected subnets assign an IPv6 address to every instance launched into them,
+// which dual-stack nodes need: autoscaling groups use launch configurations, which can't request IPv6 addresses
+// themselves. The constructs don't call it, as it changes the subnets for everything launched into them.
+// The subnets need an IPv6 CIDR. Subnets imported into the app are skipped, enable the setting on them directly.
+func AssignIpv6Addresses(vpc awsec2.IVpc, selection *awsec2.SubnetSelection) {
+	for _, subnet := range *vpc.SelectSubnets(selection).Subnets {
+		var cfn awsec2.CfnSubnet
+		if defaultChild(subnet, &cfn); cfn != nil {
+			cfn.SetAssignIpv6AddressOnCreation(jsii.Bool(true))
+		}
+	}
+}
+
+// assignIpv6Address requests an IPv6 address for an instance, whatever its subnet assigns by default.
+// The subnet needs an IPv6 CIDR.
+func assignIpv6Address(instance awsec2.Instance) {
+	var cfn awsec2.CfnInstance
+	defaultChild(instance, &cfn)
+	cfn.SetIpv6AddressCount(jsii.Number(1))
+}
+
+// allowAllIpv6Outbound adds ::/0 egress to a group created with AllowAllOutbound, which only covers IPv4.
+// AddEgressRule() ignores rules on such groups, so the rule is added as a resource of its own.
+func allowAllIpv6Outbound(sg awsec2.SecurityGroup) {
+	awsec2.NewCfnSecurityGroupEgress(sg, jsii.String("AllIpv6Egress"), &awsec2.CfnSecurityGroupEgressProps{
+		GroupId:     sg.SecurityGroupId(),
+		IpProtocol:  jsii.String("-1"),
+		CidrIpv6:    jsii.String("::/0"),
+		Description: jsii.String("Allow all outbound IPv6 traffic by default"),
+	})
+}
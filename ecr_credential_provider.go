@@ -0,0 +1,93 @@
+package taloscdk
+
+import (
+	"github.com/aws/aws-cdk-go/awscdk"
+	"github.com/aws/aws-cdk-go/awscdk/awsiam"
+	"github.com/aws/constructs-go/constructs/v3"
+	"github.com/aws/jsii-runtime-go"
+)
+
+type ECRCredentialProviderProps struct {
+	// ImageHasExtension confirms that the nodes boot an image with the siderolabs/ecr-credential-provider
+	// system extension, e.g. an AMI from the Talos Image Factory with the extension in its schematic.
+	// Nodes booted from an AMI never go through the Talos installer, so extensions can't be added through
+	// the machine config, and kubelet fails to start the provider without it.
+	// Default: jsii.Bool(false) (the construct warns that the image needs the extension)
+	ImageHasExtension *bool
+
+	// MatchImages are the image patterns kubelet requests credentials for
+	// Default: ECR registries in all partitions, e.g. *.dkr.ecr.*.amazonaws.com
+	MatchImages []string
+
+	// CacheDuration of the credentials in kubelet. ECR tokens are valid for 12 hours.
+	// Default: 12h
+	CacheDuration *string
+}
+
+// ECRCredentialProviderConfigPatch returns a config patch that configures kubelet to get credentials for
+// private ECR images from the node's IAM role with ecr-credential-provider. The binary comes from the
+// siderolabs/ecr-credential-provider system extension, which has to be part of the nodes' image.
+// The patch doesn't install the extension: machine.install.extensions only takes effect when the Talos
+// installer runs, which nodes booted from an AMI skip. Use an image that includes it, e.g. an AMI from the
+// Talos Image Factory, on Talos v1.0 or later.
+// The node role needs ECR pull permissions, see GrantECRPull().
+func ECRCredentialProviderConfigPatch(props *ECRCredentialProviderProps) map[string]interface{} {
+	if props == nil {
+		props = &ECRCredentialProviderProps{}
+	}
+
+	if props.MatchImages == nil {
+		props.MatchImages = []string{
+			"*.dkr.ecr.*.amazonaws.com",
+			"*.dkr.ecr.*.amazonaws.com.cn",
+			"*.dkr.ecr-fips.*.amazonaws.com",
+			"*.dkr.ecr.*.c2s.ic.gov",
+			"*.dkr.ecr.*.sc2s.sgov.gov",
+		}
+	}
+
+	if props.CacheDuration == nil {
+		props.CacheDuration = jsii.String("12h")
+	}
+
+	var matchImages []interface{}
+	for _, image := range props.MatchImages {
+		matchImages = append(matchImages, image)
+	}
+
+	// Talos points kubelet at the config and at /usr/local/lib/kubelet/credentialproviders,
+	// where the extension puts the binary
+	return map[string]interface{}{
+		"machine": map[string]interface{}{
+			"kubelet": map[string]interface{}{
+				"credentialProviderConfig": map[string]interface{}{
+					"apiVersion": "kubelet.config.k8s.io/v1",
+					"kind":       "CredentialProviderConfig",
+					"providers": []interface{}{
+						map[string]interface{}{
+							"name":                 "ecr-credential-provider",
+							"apiVersion":           "credentialprovider.kubelet.k8s.io/v1",
+							"defaultCacheDuration": *props.CacheDuration,
+							"matchImages":          matchImages,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// warnECRCredentialProviderImage warns on scope unless props confirm that the image has the extension
+func warnECRCredentialProviderImage(scope constructs.Construct, props *ECRCredentialProviderProps) {
+	if props.ImageHasExtension != nil && *props.ImageHasExtension {
+		return
+	}
+
+	awscdk.Annotations_Of(scope).AddWarning(jsii.String("ECRCredentialProvider needs a Talos image with the siderolabs/ecr-credential-provider system extension " +
+		"(e.g. from the Talos Image Factory), without it kubelet can't pull private ECR images. Set ImageHasExtension once the image has it."))
+}
+
+// GrantECRPull allows role to pull images from ECR, e.g. for ecr-credential-provider on control plane nodes
+func GrantECRPull(role awsiam.IRole) {
+	NewIAMPolicyBuilder(ECRPullPolicyModule()).Grant(role)
+}
@@ -0,0 +1,117 @@
+package taloscdk
+
+import (
+	"github.com/aws/aws-cdk-go/awscdk/awsec2"
+	"github.com/aws/jsii-runtime-go"
+)
+
+// amazonTimeSyncService is the link-local address of the Amazon Time Sync Service
+const amazonTimeSyncService = "169.254.169.123"
+
+// EgressRule is an outbound rule of nodes with restricted egress
+type EgressRule struct {
+	Peer        awsec2.IPeer
+	Port        awsec2.Port
+	Description *string
+}
+
+type EgressProps struct {
+	// HTTPSPeers nodes may reach on 443: image registries, the Talos discovery service and AWS APIs.
+	// Use VPC endpoint security groups or a managed prefix list (awsec2.Peer_PrefixList()) to narrow it down.
+	// Default: awsec2.Peer_AnyIpv4
+	HTTPSPeers []awsec2.IPeer
+
+	// KubernetesAPIPeers nodes may reach on 6443 besides other nodes, i.e. the control plane endpoint.
+	// The control plane NLB is internet-facing, so its addresses aren't known in advance.
+	// Default: awsec2.Peer_AnyIpv4
+	KubernetesAPIPeers []awsec2.IPeer
+
+	// DNSPeers nodes may reach on 53 (UDP and TCP)
+	// Default: the VPC CIDR (Amazon provided DNS and Route 53 Resolver endpoints) and 169.254.169.253/32
+	DNSPeers []awsec2.IPeer
+
+	// TimeServers are patched into machine.time.servers and allowed on 123 (UDP) as /32 peers.
+	// They have to be IPv4 addresses.
+	// Default: 169.254.169.123 (Amazon Time Sync Service)
+	TimeServers []string
+
+	// Rules are added to the defaults, e.g. for pods calling external services
+	// Default: nil
+	Rules []EgressRule
+}
+
+// setEgressDefaults fills in the defaults of props
+func setEgressDefaults(props *EgressProps, vpc awsec2.IVpc) {
+	if props.HTTPSPeers == nil {
+		props.HTTPSPeers = []awsec2.IPeer{awsec2.Peer_AnyIpv4()}
+	}
+
+	if props.KubernetesAPIPeers == nil {
+		props.KubernetesAPIPeers = []awsec2.IPeer{awsec2.Peer_AnyIpv4()}
+	}
+
+	if props.DNSPeers == nil {
+		props.DNSPeers = []awsec2.IPeer{awsec2.Peer_Ipv4(vpc.VpcCidrBlock()), awsec2.Peer_Ipv4(jsii.String("169.254.169.253/32"))}
+	}
+
+	if props.TimeServers == nil {
+		props.TimeServers = []string{amazonTimeSyncService}
+	}
+}
+
+// addEgressRules adds the outbound rules of props to sg, which has to be created without AllowAllOutbound.
+// Nodes may reach every node in clusterSGs.
+func addEgressRules(sg awsec2.SecurityGroup, vpc awsec2.IVpc, props *EgressProps, clusterSGs ...awsec2.ISecurityGroup) {
+	setEgressDefaults(props, vpc)
+
+	for _, peer := range clusterSGs {
+		sg.AddEgressRule(peer, awsec2.Port_AllTraffic(), jsii.String("Cluster nodes"), jsii.Bool(false))
+	}
+
+	for _, peer := range props.HTTPSPeers {
+		sg.AddEgressRule(peer, awsec2.Port_Tcp(jsii.Number(443)), jsii.String("HTTPS"), jsii.Bool(false))
+	}
+
+	for _, peer := range props.KubernetesAPIPeers {
+		sg.AddEgressRule(peer, awsec2.Port_Tcp(jsii.Number(6443)), jsii.String("Kubernetes API"), jsii.Bool(false))
+	}
+
+	for _, peer := range props.DNSPeers {
+		sg.AddEgressRule(peer, awsec2.Port_Udp(jsii.Number(53)), jsii.String("DNS"), jsii.Bool(false))
+		sg.AddEgressRule(peer, awsec2.Port_Tcp(jsii.Number(53)), jsii.String("DNS"), jsii.Bool(false))
+	}
+
+	for _, server := range props.TimeServers {
+		sg.AddEgressRule(awsec2.Peer_Ipv4(jsii.String(server+"/32")), awsec2.Port_Udp(jsii.Number(123)), jsii.String("NTP"), jsii.Bool(false))
+	}
+
+	for _, rule := range props.Rules {
+		sg.AddEgressRule(rule.Peer, rule.Port, rule.Description, jsii.Bool(false))
+	}
+}
+
+// RestrictedEgressConfigPatch returns a config patch that points machine.time.servers at the TimeServers
+// allowed by props, instead of the default time.cloudflare.com
+func RestrictedEgressConfigPatch(props *EgressProps) map[string]interface{} {
+	if props == nil {
+		props = &EgressProps{}
+	}
+
+	servers := props.TimeServers
+	if servers == nil {
+		servers = []string{amazonTimeSyncService}
+	}
+
+	var list []interface{}
+	for _, server := range servers {
+		list = append(list, server)
+	}
+
+	return map[string]interface{}{
+		"machine": map[string]interface{}{
+			"time": map[string]interface{}{
+				"servers": list,
+			},
+		},
+	}
+}
@@ -0,0 +1,126 @@
+package taloscdk
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-cdk-go/awscdk"
+	"github.com/aws/aws-cdk-go/awscdk/awsautoscaling"
+	"github.com/aws/aws-cdk-go/awscdk/awsec2"
+	"github.com/aws/aws-cdk-go/awscdk/awsiam"
+	"github.com/aws/aws-cdk-go/awscdk/awslambdago"
+	"github.com/aws/jsii-runtime-go"
+)
+
+// newStableENIs creates one network interface per control plane slot (subnet).
+// privateIPs optionally pins the address of each interface, in the same order as subnets.
+func newStableENIs(scope awscdk.Construct, subnets []awsec2.ISubnet, sg awsec2.ISecurityGroup, privateIPs *[]*string) []awsec2.CfnNetworkInterface {
+	if privateIPs != nil && len(*privateIPs) != len(subnets) {
+		panic(fmt.Sprintf("PrivateIPs has %d addresses but the control plane has %d slots (one per AZ)", len(*privateIPs), len(subnets)))
+	}
+
+	var enis []awsec2.CfnNetworkInterface
+	for i, subnet := range subnets {
+		var ip *string
+		if privateIPs != nil {
+			ip = (*privateIPs)[i]
+		}
+
+		enis = append(enis, awsec2.NewCfnNetworkInterface(scope, jsii.String(fmt.Sprintf("ENI%d", i)), &awsec2.CfnNetworkInterfaceProps{
+			SubnetId:         subnet.SubnetId(),
+			PrivateIpAddress: ip,
+			GroupSet:         &[]*string{sg.SecurityGroupId()},
+			Description:      jsii.String(fmt.Sprintf("Talos control plane node %d", i)),
+		}))
+	}
+
+	return enis
+}
+
+// stableENIConfigPatch configures the stable ENI as eth1 and makes kubelet and etcd advertise its address
+// instead of the primary interface address. Every node gets the same patch and only matches its own address.
+// eth1 gets a higher route metric, so eth0 keeps the default route. Talos can't add source based routing
+// rules, so replies from the stable address leave through eth0, which is why the attaching Lambda
+// disables the source/destination check of eth0.
+func stableENIConfigPatch(enis []awsec2.CfnNetworkInterface) map[string]interface{} {
+	var subnets []string
+	for _, eni := range enis {
+		subnets = append(subnets, fmt.Sprintf("%s/32", *eni.AttrPrimaryPrivateIpAddress()))
+	}
+
+	return map[string]interface{}{
+		"machine": map[string]interface{}{
+			"kubelet": map[string]interface{}{
+				"nodeIP": map[string]interface{}{"validSubnets": subnets},
+			},
+			"network": map[string]interface{}{
+				"interfaces": []interface{}{
+					map[string]interface{}{
+						"interface":   "eth1",
+						"dhcp":        true,
+						"dhcpOptions": map[string]interface{}{"routeMetric": 2048},
+					},
+				},
+			},
+		},
+		"cluster": map[string]interface{}{
+			"etcd": map[string]interface{}{"advertisedSubnets": subnets},
+		},
+	}
+}
+
+// attachENIsOnLaunch adds a launch lifecycle hook to each ASG that attaches the ASG's ENI
+// as the second network interface of every instance it launches.
+// asgs and enis must be in the same order. The instances and interfaces have to be tagged
+// kubernetes.io/cluster/<clusterName>, the function can only attach tagged interfaces to tagged instances.
+func attachENIsOnLaunch(scope awscdk.Construct, hooks launchHooks, asgs []awsautoscaling.AutoScalingGroup, enis []awsec2.CfnNetworkInterface, vpc awsec2.IVpc, clusterName string) {
+	// The function waits up to 4 minutes for the interface to be released by a replaced instance,
+	// the hook heartbeat has to outlast the function
+	fn := newHandlerFunction(scope, jsii.String("ENIAttachFunction"), "eniattach", &awslambdago.GoFunctionProps{
+		Timeout: awscdk.Duration_Minutes(jsii.Number(5)),
+	})
+	fn.AddToRolePolicy(awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
+		Effect:    awsiam.Effect_ALLOW,
+		Actions:   jsii.Strings("ec2:DescribeNetworkInterfaces"),
+		Resources: jsii.Strings("*"),
+	}))
+
+	fn.AddToRolePolicy(awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
+		Effect:  awsiam.Effect_ALLOW,
+		Actions: jsii.Strings("ec2:AttachNetworkInterface"),
+		Resources: jsii.Strings(
+			iamArn("ec2", "instance/*"),
+			iamArn("ec2", "network-interface/*"),
+		),
+		Conditions: &map[string]interface{}{
+			"StringEquals": map[string]interface{}{fmt.Sprintf("aws:ResourceTag/kubernetes.io/cluster/%s", clusterName): "owned"},
+		},
+	}))
+
+	// The primary interfaces of ASG instances aren't tagged, they're limited to the cluster's VPC
+	fn.AddToRolePolicy(awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
+		Effect:    awsiam.Effect_ALLOW,
+		Actions:   jsii.Strings("ec2:ModifyNetworkInterfaceAttribute"),
+		Resources: jsii.Strings(iamArn("ec2", "network-interface/*")),
+		Conditions: &map[string]interface{}{
+			"ArnEquals": map[string]interface{}{
+				"ec2:Vpc": awscdk.Fn_Sub(jsii.String("arn:${AWS::Partition}:ec2:${AWS::Region}:${AWS::AccountId}:vpc/${Vpc}"), &map[string]*string{"Vpc": vpc.VpcId()}),
+			},
+		},
+	}))
+
+	target := newLaunchHookTarget(scope, jsii.String("ENIAttachHooks"), fn, hooks)
+
+	for i, asg := range asgs {
+		target.add(asg, "AttachENI", awscdk.Fn_Sub(jsii.String(`{"networkInterfaceId":"${ENI}"}`), &map[string]*string{"ENI": enis[i].Ref()}),
+			awscdk.Duration_Minutes(jsii.Number(10)), awsautoscaling.DefaultResult_ABANDON)
+	}
+}
+
+// eniAddresses returns the primary private IP of each interface
+func eniAddresses(enis []awsec2.CfnNetworkInterface) []*string {
+	var ips []*string
+	for _, eni := range enis {
+		ips = append(ips, eni.AttrPrimaryPrivateIpAddress())
+	}
+	return ips
+}
@@ -0,0 +1,56 @@
+package taloscdk
+
+import (
+	"strings"
+
+	"github.com/aws/aws-cdk-go/awscdk"
+	"github.com/aws/aws-cdk-go/awscdk/awsautoscaling"
+	"github.com/aws/aws-cdk-go/awscdk/awsec2"
+	"github.com/aws/aws-cdk-go/awscdk/awsiam"
+	"github.com/aws/aws-cdk-go/awscdk/awssecretsmanager"
+	"github.com/aws/jsii-runtime-go"
+)
+
+// addEtcdMemberCleanup adds a termination lifecycle hook to each control plane ASG. Before an instance
+// is released, a Lambda asks the node to leave etcd, or removes its member through a remaining node.
+func addEtcdMemberCleanup(scope awscdk.Construct, asgs []awsautoscaling.AutoScalingGroup, vpc awsec2.IVpc, subnets *awsec2.SubnetSelection, nodeSG awsec2.SecurityGroup, talosconfig awssecretsmanager.ISecret) {
+	if talosconfig == nil {
+		panic("EtcdMemberCleanup requires a TalosconfigSecret")
+	}
+
+	var names, arns []string
+	for _, asg := range asgs {
+		names = append(names, *asg.AutoScalingGroupName())
+		arns = append(arns, *asg.AutoScalingGroupArn())
+	}
+
+	fn := newTalosAPIFunction(scope, jsii.String("EtcdCleanupFunction"), "etcdcleanup", vpc, subnets, nodeSG, talosconfig, map[string]*string{
+		"CONTROL_PLANE_ASGS": jsii.String(strings.Join(names, ",")),
+	}, nil)
+
+	fn.AddToRolePolicy(awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
+		Effect: awsiam.Effect_ALLOW,
+		Actions: jsii.Strings(
+			"autoscaling:DescribeAutoScalingGroups",
+			"ec2:DescribeInstances",
+		),
+		Resources: jsii.Strings("*"),
+	}))
+
+	fn.AddToRolePolicy(awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
+		Effect:    awsiam.Effect_ALLOW,
+		Actions:   jsii.Strings("autoscaling:CompleteLifecycleAction"),
+		Resources: jsii.Strings(arns...),
+	}))
+
+	target := newLifecycleHookTarget(scope, jsii.String("EtcdCleanupHooks"), fn)
+
+	for _, asg := range asgs {
+		asg.AddLifecycleHook(jsii.String("EtcdCleanup"), &awsautoscaling.BasicLifecycleHookProps{
+			LifecycleTransition: awsautoscaling.LifecycleTransition_INSTANCE_TERMINATING,
+			NotificationTarget:  target,
+			HeartbeatTimeout:    awscdk.Duration_Minutes(jsii.Number(5)),
+			DefaultResult:       awsautoscaling.DefaultResult_CONTINUE,
+		})
+	}
+}
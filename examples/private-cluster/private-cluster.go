@@ -91,9 +91,17 @@ func NewPrivateClusterStack(scope constructs.Construct, id string, props *Privat
 
 	// New Bastion host for using SSM Session Manager.
 	// Use this instance to bootstrap the cluster and run kubectl commands.
-	awsec2.NewBastionHostLinux(stack, jsii.String("BastionHost"), &awsec2.BastionHostLinuxProps{
+	bastion := awsec2.NewBastionHostLinux(stack, jsii.String("BastionHost"), &awsec2.BastionHostLinuxProps{
 		Vpc: vpc,
 	})
+
+	// The Talos API (50000-50001) is closed by default, open it to the bastion host for talosctl.
+	// The control plane nodes proxy requests to the workers.
+	cp.SecurityGroup.Connections().AllowFrom(
+		bastion,
+		awsec2.Port_TcpRange(jsii.Number(50000), jsii.Number(50001)),
+		jsii.String("Talos API from the bastion host"),
+	)
 	return stack
 }
 
@@ -41,6 +41,17 @@ func NewPublicClusterStack(scope constructs.Construct, id string, props *PublicC
 		SubnetSelection:     &awsec2.SubnetSelection{SubnetType: awsec2.SubnetType_PUBLIC},
 	})
 
+	// The Talos API (50000-50001) is closed by default. Allow talosctl from TALOS_API_CIDR, e.g. your
+	// public IP: export TALOS_API_CIDR=$(curl -s https://checkip.amazonaws.com)/32
+	if cidr := os.Getenv("TALOS_API_CIDR"); cidr != "" {
+		cp.SecurityGroup.AddIngressRule(
+			awsec2.Peer_Ipv4(jsii.String(cidr)),
+			awsec2.Port_TcpRange(jsii.Number(50000), jsii.Number(50001)),
+			jsii.String("Talos API from talosctl"),
+			jsii.Bool(false),
+		)
+	}
+
 	// Load the join.yaml worker config
 	workerConfig, err := taloscdk.LoadConfig("./join.yaml")
 	if err != nil {
@@ -4,6 +4,7 @@ import (
 	"os"
 
 	"github.com/aws/aws-cdk-go/awscdk"
+	"github.com/aws/aws-cdk-go/awscdk/awsec2"
 	"github.com/aws/constructs-go/constructs/v3"
 	"github.com/aws/jsii-runtime-go"
 	"github.com/steveyackey/taloscdk"
@@ -31,6 +32,17 @@ func NewSingleNodeStack(scope constructs.Construct, id string, props *SingleNode
 		EndpointToOverwrite: jsii.String("talos.cluster"),
 	})
 
+	// The Talos API (50000-50001) is closed by default. Allow talosctl from TALOS_API_CIDR, e.g. your
+	// public IP: export TALOS_API_CIDR=$(curl -s https://checkip.amazonaws.com)/32
+	if cidr := os.Getenv("TALOS_API_CIDR"); cidr != "" {
+		cp.SecurityGroup.AddIngressRule(
+			awsec2.Peer_Ipv4(jsii.String(cidr)),
+			awsec2.Port_TcpRange(jsii.Number(50000), jsii.Number(50001)),
+			jsii.String("Talos API from talosctl"),
+			jsii.Bool(false),
+		)
+	}
+
 	// Optional Second Node.
 	// Creating a second node will allow you to use the aws-controller-manager for
 	// loadbalancers without needing to remove the master node label on the node
@@ -54,7 +66,7 @@ func NewSingleNodeStack(scope constructs.Construct, id string, props *SingleNode
 	// 	}),
 	// 	SecurityGroup: cp.SecurityGroup,
 	// 	CreateEIP:     jsii.Bool(false),
-	// 	IAMRole:       taloscdk.NewWorkerIAMRole(stack, jsii.String("WorkerRole")),
+	// 	IAMRole:       taloscdk.NewWorkerIAMRole(stack, jsii.String("WorkerRole"), nil),
 	// })
 
 	// Output the EIP. You may need to clean this up manually when destroying this stack.
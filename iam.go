@@ -1,124 +1,114 @@
 package taloscdk
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/aws/aws-cdk-go/awscdk"
 	"github.com/aws/aws-cdk-go/awscdk/awsiam"
 	"github.com/aws/constructs-go/constructs/v3"
 	"github.com/aws/jsii-runtime-go"
 )
 
+type IAMRoleProps struct {
+	// PermissionsBoundary of the role
+	// Default: nil
+	PermissionsBoundary awsiam.IManagedPolicy
+
+	// Path of the role, e.g. /talos/
+	// Default: /
+	Path *string
+
+	// ManagedPolicies attached to the role in addition to its inline policy
+	// Default: nil
+	ManagedPolicies []awsiam.IManagedPolicy
+
+	// RoleNamePrefix names the role <prefix><id>-<hash>, with a hash of its construct path and region
+	// so it stays unique. The name is truncated to the 64 characters IAM allows.
+	// Default: nil (CloudFormation generates the name)
+	RoleNamePrefix *string
+}
+
 // NewControlPlaneIAMRole returns a new awsiam.Role with minimum permissions
 // to utilize the aws-controller-manager for creating ELBs from your cluster.
 // Returns a role with an inline policy created via taloscdk.NewControlPlaneIAMPolicyDocument()
-func NewControlPlaneIAMRole(scope constructs.Construct, id *string) awsiam.Role {
-	return awsiam.NewRole(scope, id, &awsiam.RoleProps{
-		InlinePolicies: &map[string]awsiam.PolicyDocument{
-			"ControlPlanePolicy": NewControlPlaneIAMPolicyDocument(scope, jsii.String("ControlPlanePolicy")),
-		},
-		AssumedBy: awsiam.NewServicePrincipal(jsii.String("ec2.amazonaws.com"), nil),
-	})
+// props can be nil.
+func NewControlPlaneIAMRole(scope constructs.Construct, id *string, props *IAMRoleProps) awsiam.Role {
+	return newIAMRole(scope, id, "ControlPlanePolicy", NewControlPlaneIAMPolicyDocument(scope, jsii.String("ControlPlanePolicy")), props)
 }
 
 // NewWorkerIAMRole returns a new awsiam.Role with minimum permissions
 // to utilize the aws-controller-manager for creating ELBs from your cluster.
 // Returns a role with an inline policy created via taloscdk.NewWorkerIAMPolicyDocument()
-func NewWorkerIAMRole(scope constructs.Construct, id *string) awsiam.Role {
-	return awsiam.NewRole(scope, id, &awsiam.RoleProps{
-		InlinePolicies: &map[string]awsiam.PolicyDocument{
-			"WorkerPolicy": NewWorkerIAMPolicyDocument(scope, jsii.String("WorkerPolicy")),
-		},
-		AssumedBy: awsiam.NewServicePrincipal(jsii.String("ec2.amazonaws.com"), nil),
-	})
+// props can be nil.
+func NewWorkerIAMRole(scope constructs.Construct, id *string, props *IAMRoleProps) awsiam.Role {
+	return newIAMRole(scope, id, "WorkerPolicy", NewWorkerIAMPolicyDocument(scope, jsii.String("WorkerPolicy")), props)
 }
 
+// NewControlPlaneIAMPolicyDocument returns the policy of CloudControllerPolicyModule()
 func NewControlPlaneIAMPolicyDocument(scope constructs.Construct, id *string) awsiam.PolicyDocument {
-	return awsiam.NewPolicyDocument(&awsiam.PolicyDocumentProps{
-		Statements: &[]awsiam.PolicyStatement{
-			//awsiam.PolicyStatement_FromJson(controlPlanePolicy),
-			awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
-				Effect: awsiam.Effect_ALLOW,
-				Actions: &[]*string{
-					jsii.String("autoscaling:DescribeAutoScalingGroups"),
-					jsii.String("autoscaling:DescribeLaunchConfigurations"),
-					jsii.String("autoscaling:DescribeTags"),
-					jsii.String("ec2:DescribeInstances"),
-					jsii.String("ec2:DescribeRegions"),
-					jsii.String("ec2:DescribeRouteTables"),
-					jsii.String("ec2:DescribeSecurityGroups"),
-					jsii.String("ec2:DescribeSubnets"),
-					jsii.String("ec2:DescribeVolumes"),
-					jsii.String("ec2:CreateSecurityGroup"),
-					jsii.String("ec2:CreateTags"),
-					jsii.String("ec2:CreateVolume"),
-					jsii.String("ec2:ModifyInstanceAttribute"),
-					jsii.String("ec2:ModifyVolume"),
-					jsii.String("ec2:AttachVolume"),
-					jsii.String("ec2:AuthorizeSecurityGroupIngress"),
-					jsii.String("ec2:CreateRoute"),
-					jsii.String("ec2:DeleteRoute"),
-					jsii.String("ec2:DeleteSecurityGroup"),
-					jsii.String("ec2:DeleteVolume"),
-					jsii.String("ec2:DetachVolume"),
-					jsii.String("ec2:RevokeSecurityGroupIngress"),
-					jsii.String("ec2:DescribeVpcs"),
-					jsii.String("elasticloadbalancing:AddTags"),
-					jsii.String("elasticloadbalancing:AttachLoadBalancerToSubnets"),
-					jsii.String("elasticloadbalancing:ApplySecurityGroupsToLoadBalancer"),
-					jsii.String("elasticloadbalancing:CreateLoadBalancer"),
-					jsii.String("elasticloadbalancing:CreateLoadBalancerPolicy"),
-					jsii.String("elasticloadbalancing:CreateLoadBalancerListeners"),
-					jsii.String("elasticloadbalancing:ConfigureHealthCheck"),
-					jsii.String("elasticloadbalancing:DeleteLoadBalancer"),
-					jsii.String("elasticloadbalancing:DeleteLoadBalancerListeners"),
-					jsii.String("elasticloadbalancing:DescribeLoadBalancers"),
-					jsii.String("elasticloadbalancing:DescribeLoadBalancerAttributes"),
-					jsii.String("elasticloadbalancing:DetachLoadBalancerFromSubnets"),
-					jsii.String("elasticloadbalancing:DeregisterInstancesFromLoadBalancer"),
-					jsii.String("elasticloadbalancing:ModifyLoadBalancerAttributes"),
-					jsii.String("elasticloadbalancing:RegisterInstancesWithLoadBalancer"),
-					jsii.String("elasticloadbalancing:SetLoadBalancerPoliciesForBackendServer"),
-					jsii.String("elasticloadbalancing:AddTags"),
-					jsii.String("elasticloadbalancing:CreateListener"),
-					jsii.String("elasticloadbalancing:CreateTargetGroup"),
-					jsii.String("elasticloadbalancing:DeleteListener"),
-					jsii.String("elasticloadbalancing:DeleteTargetGroup"),
-					jsii.String("elasticloadbalancing:DescribeListeners"),
-					jsii.String("elasticloadbalancing:DescribeLoadBalancerPolicies"),
-					jsii.String("elasticloadbalancing:DescribeTargetGroups"),
-					jsii.String("elasticloadbalancing:DescribeTargetHealth"),
-					jsii.String("elasticloadbalancing:ModifyListener"),
-					jsii.String("elasticloadbalancing:ModifyTargetGroup"),
-					jsii.String("elasticloadbalancing:RegisterTargets"),
-					jsii.String("elasticloadbalancing:DeregisterTargets"),
-					jsii.String("elasticloadbalancing:SetLoadBalancerPoliciesOfListener"),
-					jsii.String("iam:CreateServiceLinkedRole"),
-					jsii.String("kms:DescribeKey"),
-				},
-				Resources: jsii.Strings("*"),
-			}),
-		},
-	})
+	return NewIAMPolicyBuilder(CloudControllerPolicyModule()).Document()
 }
 
+// NewWorkerIAMPolicyDocument returns the policy of WorkerCloudControllerPolicyModule() and ECRPullPolicyModule()
 func NewWorkerIAMPolicyDocument(scope constructs.Construct, id *string) awsiam.PolicyDocument {
-	policy := awsiam.NewPolicyDocument(&awsiam.PolicyDocumentProps{
-		Statements: &[]awsiam.PolicyStatement{
-			awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
-				Effect: awsiam.Effect_ALLOW,
-				Actions: &[]*string{
-					jsii.String("ec2:DescribeInstances"),
-					jsii.String("ec2:DescribeRegions"),
-					jsii.String("ecr:GetAuthorizationToken"),
-					jsii.String("ecr:BatchCheckLayerAvailability"),
-					jsii.String("ecr:GetDownloadUrlForLayer"),
-					jsii.String("ecr:GetRepositoryPolicy"),
-					jsii.String("ecr:DescribeRepositories"),
-					jsii.String("ecr:ListImages"),
-					jsii.String("ecr:BatchGetImage"),
-				},
-				Resources: jsii.Strings("*"),
-			}),
-		},
-	})
-
-	return policy
+	return NewIAMPolicyBuilder(WorkerCloudControllerPolicyModule(), ECRPullPolicyModule()).Document()
+}
+
+// NewScopedControlPlaneIAMRole returns a new awsiam.Role with the same capabilities as NewControlPlaneIAMRole(),
+// but mutating actions are only allowed on resources tagged for clusterName.
+// Returns a role with an inline policy created via taloscdk.NewScopedControlPlaneIAMPolicyDocument()
+// props can be nil.
+func NewScopedControlPlaneIAMRole(scope constructs.Construct, id *string, clusterName string, props *IAMRoleProps) awsiam.Role {
+	return newIAMRole(scope, id, "ControlPlanePolicy", NewScopedControlPlaneIAMPolicyDocument(scope, jsii.String("ControlPlanePolicy"), clusterName), props)
+}
+
+// NewScopedControlPlaneIAMPolicyDocument returns the policy of ScopedCloudControllerPolicyModule(clusterName)
+func NewScopedControlPlaneIAMPolicyDocument(scope constructs.Construct, id *string, clusterName string) awsiam.PolicyDocument {
+	return NewIAMPolicyBuilder(ScopedCloudControllerPolicyModule(clusterName)).Document()
+}
+
+// newIAMRole returns a role for EC2 instances with document as inline policy policyName (if not nil)
+func newIAMRole(scope constructs.Construct, id *string, policyName string, document awsiam.PolicyDocument, props *IAMRoleProps) awsiam.Role {
+	if props == nil {
+		props = &IAMRoleProps{}
+	}
+
+	roleProps := &awsiam.RoleProps{
+		AssumedBy:           awsiam.NewServicePrincipal(jsii.String("ec2.amazonaws.com"), nil),
+		PermissionsBoundary: props.PermissionsBoundary,
+		Path:                props.Path,
+	}
+
+	if document != nil {
+		roleProps.InlinePolicies = &map[string]awsiam.PolicyDocument{policyName: document}
+	}
+
+	if props.ManagedPolicies != nil {
+		roleProps.ManagedPolicies = &props.ManagedPolicies
+	}
+
+	if props.RoleNamePrefix != nil {
+		roleProps.RoleName = prefixedRoleName(scope, id, *props.RoleNamePrefix)
+	}
+
+	return awsiam.NewRole(scope, id, roleProps)
+}
+
+// prefixedRoleName returns <prefix><id>-<hash>, unique for the construct path and region
+func prefixedRoleName(scope constructs.Construct, id *string, prefix string) *string {
+	unique := *constructs.Node_Of(scope).Path() + "/" + *id
+	if region := awscdk.Stack_Of(scope).Region(); !*awscdk.Token_IsUnresolved(region) {
+		unique += "@" + *region
+	}
+
+	sum := sha256.Sum256([]byte(unique))
+	suffix := "-" + hex.EncodeToString(sum[:])[:8]
+
+	name := prefix + *id
+	if max := 64 - len(suffix); len(name) > max {
+		name = name[:max]
+	}
+
+	return jsii.String(name + suffix)
 }
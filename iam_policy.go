@@ -0,0 +1,810 @@
+package taloscdk
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/aws/aws-cdk-go/awscdk"
+	"github.com/aws/aws-cdk-go/awscdk/awsiam"
+	"github.com/aws/aws-cdk-go/awscdk/awskms"
+	"github.com/aws/constructs-go/constructs/v3"
+	"github.com/aws/jsii-runtime-go"
+)
+
+// Names of the built-in IAM policy modules, for IAMPolicyBuilder.Remove() and Has()
+const (
+	IAMModuleCloudController           = "cloud-controller"
+	IAMModuleWorkerCloudController     = "worker-cloud-controller"
+	IAMModuleEBSCSIDriver              = "ebs-csi-driver"
+	IAMModuleECRPull                   = "ecr-pull"
+	IAMModuleECRPullThroughCache       = "ecr-pull-through-cache"
+	IAMModuleSSM                       = "ssm"
+	IAMModuleClusterAutoscaler         = "cluster-autoscaler"
+	IAMModuleCloudWatch                = "cloudwatch"
+	IAMModuleAWSLoadBalancerController = "aws-load-balancer-controller"
+)
+
+// IAMStatement is an Allow statement of an IAMPolicyModule
+type IAMStatement struct {
+	Actions    []string
+	Resources  []string
+	Conditions map[string]interface{}
+}
+
+// IAMPolicyModule is a capability of a node role, e.g. running the cloud controller or pulling from ECR
+type IAMPolicyModule struct {
+	// Name identifies the module. Adding a module with the same name as an existing one replaces it.
+	Name       string
+	Statements []IAMStatement
+}
+
+// IAMPolicyBuilder combines IAMPolicyModules into a single policy. Statements with the same resources
+// and conditions are merged and duplicate actions are removed, so modules may overlap.
+//
+// Example:
+//
+//	role := taloscdk.NewIAMPolicyBuilder(taloscdk.WorkerCloudControllerPolicyModule(), taloscdk.ECRPullPolicyModule()).
+//		Add(taloscdk.SSMPolicyModule(), taloscdk.CloudWatchPolicyModule()).
+//		NewRole(stack, jsii.String("WorkerRole"), nil)
+type IAMPolicyBuilder struct {
+	modules []IAMPolicyModule
+}
+
+// NewIAMPolicyBuilder returns a builder with modules
+func NewIAMPolicyBuilder(modules ...IAMPolicyModule) *IAMPolicyBuilder {
+	return (&IAMPolicyBuilder{}).Add(modules...)
+}
+
+// Add adds modules, replacing existing modules with the same name
+func (b *IAMPolicyBuilder) Add(modules ...IAMPolicyModule) *IAMPolicyBuilder {
+	for _, module := range modules {
+		b.Remove(module.Name)
+		b.modules = append(b.modules, module)
+	}
+	return b
+}
+
+// Remove removes the modules named names
+func (b *IAMPolicyBuilder) Remove(names ...string) *IAMPolicyBuilder {
+	for _, name := range names {
+		for i, module := range b.modules {
+			if module.Name == name {
+				b.modules = append(b.modules[:i], b.modules[i+1:]...)
+				break
+			}
+		}
+	}
+	return b
+}
+
+// Has returns whether the module named name has been added
+func (b *IAMPolicyBuilder) Has(name string) bool {
+	for _, module := range b.modules {
+		if module.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Statements returns the merged statements of all modules
+func (b *IAMPolicyBuilder) Statements() []awsiam.PolicyStatement {
+	type mergedStatement struct {
+		actions    []string
+		seen       map[string]bool
+		resources  []string
+		conditions map[string]interface{}
+	}
+
+	var keys []string
+	merged := map[string]*mergedStatement{}
+
+	for _, module := range b.modules {
+		for _, statement := range module.Statements {
+			resources := append([]string(nil), statement.Resources...)
+			sort.Strings(resources)
+
+			key, err := json.Marshal([]interface{}{resources, statement.Conditions})
+			if err != nil {
+				panic(fmt.Sprintf("Could not encode statement of IAM policy module %s: %v", module.Name, err))
+			}
+
+			m, ok := merged[string(key)]
+			if !ok {
+				m = &mergedStatement{seen: map[string]bool{}, resources: resources, conditions: statement.Conditions}
+				merged[string(key)] = m
+				keys = append(keys, string(key))
+			}
+
+			for _, action := range statement.Actions {
+				if !m.seen[action] {
+					m.seen[action] = true
+					m.actions = append(m.actions, action)
+				}
+			}
+		}
+	}
+
+	var statements []awsiam.PolicyStatement
+	for _, key := range keys {
+		m := merged[key]
+		sort.Strings(m.actions)
+
+		props := &awsiam.PolicyStatementProps{
+			Effect:    awsiam.Effect_ALLOW,
+			Actions:   jsii.Strings(m.actions...),
+			Resources: jsii.Strings(m.resources...),
+		}
+		if m.conditions != nil {
+			props.Conditions = &m.conditions
+		}
+
+		statements = append(statements, awsiam.NewPolicyStatement(props))
+	}
+
+	return statements
+}
+
+// Document returns the merged statements as a policy document
+func (b *IAMPolicyBuilder) Document() awsiam.PolicyDocument {
+	statements := b.Statements()
+
+	return awsiam.NewPolicyDocument(&awsiam.PolicyDocumentProps{
+		Statements: &statements,
+	})
+}
+
+// Grant adds the merged statements to the policy of role
+func (b *IAMPolicyBuilder) Grant(role awsiam.IRole) {
+	for _, statement := range b.Statements() {
+		role.AddToPrincipalPolicy(statement)
+	}
+}
+
+// NewRole returns a new awsiam.Role for EC2 instances with the merged statements as inline policy.
+// props may be nil.
+func (b *IAMPolicyBuilder) NewRole(scope constructs.Construct, id *string, props *IAMRoleProps) awsiam.Role {
+	var document awsiam.PolicyDocument
+	if len(b.modules) > 0 {
+		document = b.Document()
+	}
+
+	return newIAMRole(scope, id, "NodePolicy", document, props)
+}
+
+// iamArn returns an ARN for resource of service in any region and account of the current partition
+func iamArn(service string, resource string) string {
+	return fmt.Sprintf("arn:%s:%s:*:*:%s", *awscdk.Aws_PARTITION(), service, resource)
+}
+
+// CloudControllerPolicyModule allows the control plane to run the AWS cloud controller (in-tree or
+// cloud-provider-aws): creating ELBs and their security groups, routes and volumes.
+func CloudControllerPolicyModule() IAMPolicyModule {
+	return IAMPolicyModule{
+		Name: IAMModuleCloudController,
+		Statements: []IAMStatement{
+			{
+				Actions: []string{
+					"autoscaling:DescribeAutoScalingGroups",
+					"autoscaling:DescribeLaunchConfigurations",
+					"autoscaling:DescribeTags",
+					"ec2:DescribeInstances",
+					"ec2:DescribeRegions",
+					"ec2:DescribeRouteTables",
+					"ec2:DescribeSecurityGroups",
+					"ec2:DescribeSubnets",
+					"ec2:DescribeVolumes",
+					"ec2:CreateSecurityGroup",
+					"ec2:CreateTags",
+					"ec2:CreateVolume",
+					"ec2:ModifyInstanceAttribute",
+					"ec2:ModifyVolume",
+					"ec2:AttachVolume",
+					"ec2:AuthorizeSecurityGroupIngress",
+					"ec2:CreateRoute",
+					"ec2:DeleteRoute",
+					"ec2:DeleteSecurityGroup",
+					"ec2:DeleteVolume",
+					"ec2:DetachVolume",
+					"ec2:RevokeSecurityGroupIngress",
+					"ec2:DescribeVpcs",
+					"elasticloadbalancing:AddTags",
+					"elasticloadbalancing:AttachLoadBalancerToSubnets",
+					"elasticloadbalancing:ApplySecurityGroupsToLoadBalancer",
+					"elasticloadbalancing:CreateLoadBalancer",
+					"elasticloadbalancing:CreateLoadBalancerPolicy",
+					"elasticloadbalancing:CreateLoadBalancerListeners",
+					"elasticloadbalancing:ConfigureHealthCheck",
+					"elasticloadbalancing:DeleteLoadBalancer",
+					"elasticloadbalancing:DeleteLoadBalancerListeners",
+					"elasticloadbalancing:DescribeLoadBalancers",
+					"elasticloadbalancing:DescribeLoadBalancerAttributes",
+					"elasticloadbalancing:DetachLoadBalancerFromSubnets",
+					"elasticloadbalancing:DeregisterInstancesFromLoadBalancer",
+					"elasticloadbalancing:ModifyLoadBalancerAttributes",
+					"elasticloadbalancing:RegisterInstancesWithLoadBalancer",
+					"elasticloadbalancing:SetLoadBalancerPoliciesForBackendServer",
+					"elasticloadbalancing:CreateListener",
+					"elasticloadbalancing:CreateTargetGroup",
+					"elasticloadbalancing:DeleteListener",
+					"elasticloadbalancing:DeleteTargetGroup",
+					"elasticloadbalancing:DescribeListeners",
+					"elasticloadbalancing:DescribeLoadBalancerPolicies",
+					"elasticloadbalancing:DescribeTargetGroups",
+					"elasticloadbalancing:DescribeTargetHealth",
+					"elasticloadbalancing:ModifyListener",
+					"elasticloadbalancing:ModifyTargetGroup",
+					"elasticloadbalancing:RegisterTargets",
+					"elasticloadbalancing:DeregisterTargets",
+					"elasticloadbalancing:SetLoadBalancerPoliciesOfListener",
+					"iam:CreateServiceLinkedRole",
+					"kms:DescribeKey",
+				},
+				Resources: []string{"*"},
+			},
+		},
+	}
+}
+
+// ScopedCloudControllerPolicyModule is the least-privilege variant of CloudControllerPolicyModule().
+// Describes are allowed on "*", everything else needs the kubernetes.io/cluster/<clusterName> tag
+// (owned or shared): on the resource for changes, and in the request for creating load balancers,
+// target groups, security groups and volumes. The constructs tag their instances and security groups;
+// route tables the cloud controller manages routes in have to be tagged as well.
+func ScopedCloudControllerPolicyModule(clusterName string) IAMPolicyModule {
+	tagKey := fmt.Sprintf("kubernetes.io/cluster/%s", clusterName)
+	tagValues := []string{"owned", "shared"}
+
+	return IAMPolicyModule{
+		Name: IAMModuleCloudController,
+		Statements: []IAMStatement{
+			{
+				Actions: []string{
+					"autoscaling:DescribeAutoScalingGroups",
+					"autoscaling:DescribeLaunchConfigurations",
+					"autoscaling:DescribeTags",
+					"ec2:DescribeAvailabilityZones",
+					"ec2:DescribeInstances",
+					"ec2:DescribeRegions",
+					"ec2:DescribeRouteTables",
+					"ec2:DescribeSecurityGroups",
+					"ec2:DescribeSubnets",
+					"ec2:DescribeVolumes",
+					"ec2:DescribeVpcs",
+					"elasticloadbalancing:DescribeListeners",
+					"elasticloadbalancing:DescribeLoadBalancerAttributes",
+					"elasticloadbalancing:DescribeLoadBalancerPolicies",
+					"elasticloadbalancing:DescribeLoadBalancers",
+					"elasticloadbalancing:DescribeTargetGroups",
+					"elasticloadbalancing:DescribeTargetHealth",
+					"kms:DescribeKey",
+				},
+				Resources: []string{"*"},
+			},
+			// Creating security groups is authorized against the VPC as well, which is not tagged
+			{
+				Actions:   []string{"ec2:CreateSecurityGroup"},
+				Resources: []string{iamArn("ec2", "vpc/*")},
+			},
+			{
+				Actions: []string{
+					"ec2:CreateSecurityGroup",
+					"ec2:CreateVolume",
+					"elasticloadbalancing:CreateLoadBalancer",
+					"elasticloadbalancing:CreateTargetGroup",
+				},
+				Resources: []string{"*"},
+				Conditions: map[string]interface{}{
+					"StringEquals": map[string]interface{}{"aws:RequestTag/" + tagKey: tagValues},
+				},
+			},
+			// Tagging on creation, or resources that already belong to the cluster
+			{
+				Actions:   []string{"ec2:CreateTags"},
+				Resources: []string{"*"},
+				Conditions: map[string]interface{}{
+					"StringEquals": map[string]interface{}{"ec2:CreateAction": []string{"CreateSecurityGroup", "CreateVolume"}},
+				},
+			},
+			{
+				Actions:   []string{"elasticloadbalancing:AddTags"},
+				Resources: []string{"*"},
+				Conditions: map[string]interface{}{
+					"StringEquals": map[string]interface{}{"elasticloadbalancing:CreateAction": []string{"CreateLoadBalancer", "CreateTargetGroup"}},
+				},
+			},
+			{
+				Actions: []string{
+					"ec2:AttachVolume",
+					"ec2:AuthorizeSecurityGroupIngress",
+					"ec2:CreateRoute",
+					"ec2:CreateTags",
+					"ec2:DeleteRoute",
+					"ec2:DeleteSecurityGroup",
+					"ec2:DeleteVolume",
+					"ec2:DetachVolume",
+					"ec2:ModifyInstanceAttribute",
+					"ec2:ModifyVolume",
+					"ec2:RevokeSecurityGroupIngress",
+					"elasticloadbalancing:AddTags",
+					"elasticloadbalancing:ApplySecurityGroupsToLoadBalancer",
+					"elasticloadbalancing:AttachLoadBalancerToSubnets",
+					"elasticloadbalancing:ConfigureHealthCheck",
+					"elasticloadbalancing:CreateListener",
+					"elasticloadbalancing:CreateLoadBalancerListeners",
+					"elasticloadbalancing:CreateLoadBalancerPolicy",
+					"elasticloadbalancing:DeleteLoadBalancer",
+					"elasticloadbalancing:DeleteLoadBalancerListeners",
+					"elasticloadbalancing:DeleteTargetGroup",
+					"elasticloadbalancing:DeregisterInstancesFromLoadBalancer",
+					"elasticloadbalancing:DeregisterTargets",
+					"elasticloadbalancing:DetachLoadBalancerFromSubnets",
+					"elasticloadbalancing:ModifyLoadBalancerAttributes",
+					"elasticloadbalancing:ModifyTargetGroup",
+					"elasticloadbalancing:RegisterInstancesWithLoadBalancer",
+					"elasticloadbalancing:RegisterTargets",
+					"elasticloadbalancing:SetLoadBalancerPoliciesForBackendServer",
+					"elasticloadbalancing:SetLoadBalancerPoliciesOfListener",
+				},
+				Resources: []string{"*"},
+				Conditions: map[string]interface{}{
+					"StringEquals": map[string]interface{}{"aws:ResourceTag/" + tagKey: tagValues},
+				},
+			},
+			// Listeners aren't tagged by the cloud controller, limit them to listener ARNs
+			{
+				Actions: []string{
+					"elasticloadbalancing:DeleteListener",
+					"elasticloadbalancing:ModifyListener",
+				},
+				Resources: []string{iamArn("elasticloadbalancing", "listener/*")},
+			},
+			{
+				Actions:   []string{"iam:CreateServiceLinkedRole"},
+				Resources: []string{"*"},
+				Conditions: map[string]interface{}{
+					"StringEquals": map[string]interface{}{"iam:AWSServiceName": "elasticloadbalancing.amazonaws.com"},
+				},
+			},
+		},
+	}
+}
+
+// WorkerCloudControllerPolicyModule allows the kubelet of workers to look up their instance
+func WorkerCloudControllerPolicyModule() IAMPolicyModule {
+	return IAMPolicyModule{
+		Name: IAMModuleWorkerCloudController,
+		Statements: []IAMStatement{
+			{
+				Actions: []string{
+					"ec2:DescribeInstances",
+					"ec2:DescribeRegions",
+				},
+				Resources: []string{"*"},
+			},
+		},
+	}
+}
+
+// ECRPullPolicyModule allows pulling images from ECR
+func ECRPullPolicyModule() IAMPolicyModule {
+	return IAMPolicyModule{
+		Name: IAMModuleECRPull,
+		Statements: []IAMStatement{
+			{
+				Actions: []string{
+					"ecr:GetAuthorizationToken",
+					"ecr:BatchCheckLayerAvailability",
+					"ecr:GetDownloadUrlForLayer",
+					"ecr:GetRepositoryPolicy",
+					"ecr:DescribeRepositories",
+					"ecr:ListImages",
+					"ecr:BatchGetImage",
+				},
+				Resources: []string{"*"},
+			},
+		},
+	}
+}
+
+// ECRPullThroughCachePolicyModule allows pulls through the ECR pull-through cache rules with the given
+// repository prefixes to create the cached repositories and import images from the upstream registry.
+// Combine it with ECRPullPolicyModule().
+func ECRPullThroughCachePolicyModule(prefixes []string) IAMPolicyModule {
+	var repositories []string
+	for _, prefix := range prefixes {
+		repositories = append(repositories, iamArn("ecr", "repository/"+prefix+"/*"))
+	}
+
+	return IAMPolicyModule{
+		Name: IAMModuleECRPullThroughCache,
+		Statements: []IAMStatement{
+			{
+				Actions: []string{
+					"ecr:CreateRepository",
+					"ecr:BatchImportUpstreamImage",
+				},
+				Resources: repositories,
+			},
+		},
+	}
+}
+
+// SSMPolicyModule allows an SSM agent on the node (e.g. from a Talos system extension or a DaemonSet)
+// to register with Systems Manager, following the AmazonSSMManagedInstanceCore managed policy.
+func SSMPolicyModule() IAMPolicyModule {
+	return IAMPolicyModule{
+		Name: IAMModuleSSM,
+		Statements: []IAMStatement{
+			{
+				Actions: []string{
+					"ssm:DescribeAssociation",
+					"ssm:GetDeployablePatchSnapshotForInstance",
+					"ssm:GetDocument",
+					"ssm:DescribeDocument",
+					"ssm:GetManifest",
+					"ssm:GetParameter",
+					"ssm:GetParameters",
+					"ssm:ListAssociations",
+					"ssm:ListInstanceAssociations",
+					"ssm:PutInventory",
+					"ssm:PutComplianceItems",
+					"ssm:PutConfigurePackageResult",
+					"ssm:UpdateAssociationStatus",
+					"ssm:UpdateInstanceAssociationStatus",
+					"ssm:UpdateInstanceInformation",
+					"ssmmessages:CreateControlChannel",
+					"ssmmessages:CreateDataChannel",
+					"ssmmessages:OpenControlChannel",
+					"ssmmessages:OpenDataChannel",
+					"ec2messages:AcknowledgeMessage",
+					"ec2messages:DeleteMessage",
+					"ec2messages:FailMessage",
+					"ec2messages:GetEndpoint",
+					"ec2messages:GetMessages",
+					"ec2messages:SendReply",
+				},
+				Resources: []string{"*"},
+			},
+		},
+	}
+}
+
+// CloudWatchPolicyModule allows shipping logs and metrics to CloudWatch (e.g. from the CloudWatch agent or
+// Fluent Bit), following the CloudWatchAgentServerPolicy managed policy.
+func CloudWatchPolicyModule() IAMPolicyModule {
+	return IAMPolicyModule{
+		Name: IAMModuleCloudWatch,
+		Statements: []IAMStatement{
+			{
+				Actions: []string{
+					"cloudwatch:PutMetricData",
+					"ec2:DescribeTags",
+					"ec2:DescribeVolumes",
+					"logs:CreateLogGroup",
+					"logs:CreateLogStream",
+					"logs:DescribeLogGroups",
+					"logs:DescribeLogStreams",
+					"logs:PutLogEvents",
+					"logs:PutRetentionPolicy",
+				},
+				Resources: []string{"*"},
+			},
+		},
+	}
+}
+
+// ClusterAutoscalerPolicyModule allows running the cluster autoscaler. Groups can only be scaled if they're
+// tagged with k8s.io/cluster-autoscaler/<clusterName>=owned.
+func ClusterAutoscalerPolicyModule(clusterName string) IAMPolicyModule {
+	return IAMPolicyModule{
+		Name: IAMModuleClusterAutoscaler,
+		Statements: []IAMStatement{
+			{
+				Actions: []string{
+					"autoscaling:DescribeAutoScalingGroups",
+					"autoscaling:DescribeAutoScalingInstances",
+					"autoscaling:DescribeLaunchConfigurations",
+					"autoscaling:DescribeScalingActivities",
+					"autoscaling:DescribeTags",
+					"ec2:DescribeImages",
+					"ec2:DescribeInstanceTypes",
+					"ec2:DescribeLaunchTemplateVersions",
+					"ec2:GetInstanceTypesFromInstanceRequirements",
+				},
+				Resources: []string{"*"},
+			},
+			{
+				Actions: []string{
+					"autoscaling:SetDesiredCapacity",
+					"autoscaling:TerminateInstanceInAutoScalingGroup",
+				},
+				Resources: []string{"*"},
+				Conditions: map[string]interface{}{
+					"StringEquals": map[string]interface{}{
+						fmt.Sprintf("aws:ResourceTag/k8s.io/cluster-autoscaler/%s", clusterName): "owned",
+					},
+				},
+			},
+		},
+	}
+}
+
+// EBSCSIDriverPolicyModule allows running the EBS CSI driver controller, following the AmazonEBSCSIDriverPolicy
+// managed policy. Volumes can only be deleted if the driver created them. If key is given, the driver may use it
+// for encrypted volumes.
+func EBSCSIDriverPolicyModule(key awskms.IKey) IAMPolicyModule {
+	volumesAndSnapshots := []string{
+		iamArn("ec2", "volume/*"),
+		fmt.Sprintf("arn:%s:ec2:*::snapshot/*", *awscdk.Aws_PARTITION()),
+	}
+
+	statements := []IAMStatement{
+		{
+			Actions: []string{
+				"ec2:CreateSnapshot",
+				"ec2:AttachVolume",
+				"ec2:DetachVolume",
+				"ec2:ModifyVolume",
+				"ec2:DescribeAvailabilityZones",
+				"ec2:DescribeInstances",
+				"ec2:DescribeSnapshots",
+				"ec2:DescribeTags",
+				"ec2:DescribeVolumes",
+				"ec2:DescribeVolumesModifications",
+			},
+			Resources: []string{"*"},
+		},
+		{
+			Actions:   []string{"ec2:CreateTags"},
+			Resources: volumesAndSnapshots,
+			Conditions: map[string]interface{}{
+				"StringEquals": map[string]interface{}{"ec2:CreateAction": []string{"CreateVolume", "CreateSnapshot"}},
+			},
+		},
+		{
+			Actions:   []string{"ec2:DeleteTags"},
+			Resources: volumesAndSnapshots,
+		},
+		{
+			Actions:   []string{"ec2:CreateVolume"},
+			Resources: []string{"*"},
+			Conditions: map[string]interface{}{
+				"StringLike": map[string]interface{}{"aws:RequestTag/ebs.csi.aws.com/cluster": "true"},
+			},
+		},
+		{
+			Actions:   []string{"ec2:DeleteVolume", "ec2:DeleteSnapshot"},
+			Resources: []string{"*"},
+			Conditions: map[string]interface{}{
+				"StringLike": map[string]interface{}{"ec2:ResourceTag/ebs.csi.aws.com/cluster": "true"},
+			},
+		},
+	}
+
+	if key != nil {
+		statements = append(statements,
+			IAMStatement{
+				Actions:   []string{"kms:CreateGrant", "kms:ListGrants", "kms:RevokeGrant"},
+				Resources: []string{*key.KeyArn()},
+				Conditions: map[string]interface{}{
+					"Bool": map[string]interface{}{"kms:GrantIsForAWSResource": "true"},
+				},
+			},
+			IAMStatement{
+				Actions: []string{
+					"kms:Encrypt",
+					"kms:Decrypt",
+					"kms:ReEncrypt*",
+					"kms:GenerateDataKey*",
+					"kms:DescribeKey",
+				},
+				Resources: []string{*key.KeyArn()},
+			},
+		)
+	}
+
+	return IAMPolicyModule{Name: IAMModuleEBSCSIDriver, Statements: statements}
+}
+
+// AWSLoadBalancerControllerPolicyModule allows running the AWS Load Balancer Controller, following the upstream
+// iam_policy.json. It covers ALB ingresses, NLBs with IP targets and TargetGroupBindings.
+func AWSLoadBalancerControllerPolicyModule() IAMPolicyModule {
+	loadBalancersAndTargetGroups := []string{
+		iamArn("elasticloadbalancing", "targetgroup/*/*"),
+		iamArn("elasticloadbalancing", "loadbalancer/net/*/*"),
+		iamArn("elasticloadbalancing", "loadbalancer/app/*/*"),
+	}
+
+	return IAMPolicyModule{
+		Name: IAMModuleAWSLoadBalancerController,
+		Statements: []IAMStatement{
+			{
+				Actions:   []string{"iam:CreateServiceLinkedRole"},
+				Resources: []string{"*"},
+				Conditions: map[string]interface{}{
+					"StringEquals": map[string]interface{}{"iam:AWSServiceName": "elasticloadbalancing.amazonaws.com"},
+				},
+			},
+			{
+				Actions: []string{
+					"ec2:DescribeAccountAttributes",
+					"ec2:DescribeAddresses",
+					"ec2:DescribeAvailabilityZones",
+					"ec2:DescribeInternetGateways",
+					"ec2:DescribeVpcs",
+					"ec2:DescribeVpcPeeringConnections",
+					"ec2:DescribeSubnets",
+					"ec2:DescribeSecurityGroups",
+					"ec2:DescribeInstances",
+					"ec2:DescribeNetworkInterfaces",
+					"ec2:DescribeTags",
+					"ec2:GetCoipPoolUsage",
+					"ec2:DescribeCoipPools",
+					"ec2:GetSecurityGroupsForVpc",
+					"elasticloadbalancing:DescribeLoadBalancers",
+					"elasticloadbalancing:DescribeLoadBalancerAttributes",
+					"elasticloadbalancing:DescribeListeners",
+					"elasticloadbalancing:DescribeListenerCertificates",
+					"elasticloadbalancing:DescribeListenerAttributes",
+					"elasticloadbalancing:DescribeSSLPolicies",
+					"elasticloadbalancing:DescribeRules",
+					"elasticloadbalancing:DescribeTargetGroups",
+					"elasticloadbalancing:DescribeTargetGroupAttributes",
+					"elasticloadbalancing:DescribeTargetHealth",
+					"elasticloadbalancing:DescribeTags",
+					"elasticloadbalancing:DescribeTrustStores",
+					"elasticloadbalancing:DescribeCapacityReservation",
+				},
+				Resources: []string{"*"},
+			},
+			{
+				Actions: []string{
+					"cognito-idp:DescribeUserPoolClient",
+					"acm:ListCertificates",
+					"acm:DescribeCertificate",
+					"iam:ListServerCertificates",
+					"iam:GetServerCertificate",
+					"waf-regional:GetWebACL",
+					"waf-regional:GetWebACLForResource",
+					"waf-regional:AssociateWebACL",
+					"waf-regional:DisassociateWebACL",
+					"wafv2:GetWebACL",
+					"wafv2:GetWebACLForResource",
+					"wafv2:AssociateWebACL",
+					"wafv2:DisassociateWebACL",
+					"shield:GetSubscriptionState",
+					"shield:DescribeProtection",
+					"shield:CreateProtection",
+					"shield:DeleteProtection",
+				},
+				Resources: []string{"*"},
+			},
+			{
+				Actions: []string{
+					"ec2:AuthorizeSecurityGroupIngress",
+					"ec2:RevokeSecurityGroupIngress",
+					"ec2:CreateSecurityGroup",
+				},
+				Resources: []string{"*"},
+			},
+			{
+				Actions:   []string{"ec2:CreateTags"},
+				Resources: []string{iamArn("ec2", "security-group/*")},
+				Conditions: map[string]interface{}{
+					"StringEquals": map[string]interface{}{"ec2:CreateAction": "CreateSecurityGroup"},
+					"Null":         map[string]interface{}{"aws:RequestTag/elbv2.k8s.aws/cluster": "false"},
+				},
+			},
+			{
+				Actions:   []string{"ec2:CreateTags", "ec2:DeleteTags"},
+				Resources: []string{iamArn("ec2", "security-group/*")},
+				Conditions: map[string]interface{}{
+					"Null": map[string]interface{}{
+						"aws:RequestTag/elbv2.k8s.aws/cluster":  "true",
+						"aws:ResourceTag/elbv2.k8s.aws/cluster": "false",
+					},
+				},
+			},
+			{
+				Actions: []string{
+					"ec2:AuthorizeSecurityGroupIngress",
+					"ec2:RevokeSecurityGroupIngress",
+					"ec2:DeleteSecurityGroup",
+				},
+				Resources: []string{"*"},
+				Conditions: map[string]interface{}{
+					"Null": map[string]interface{}{"aws:ResourceTag/elbv2.k8s.aws/cluster": "false"},
+				},
+			},
+			{
+				Actions: []string{
+					"elasticloadbalancing:CreateLoadBalancer",
+					"elasticloadbalancing:CreateTargetGroup",
+				},
+				Resources: []string{"*"},
+				Conditions: map[string]interface{}{
+					"Null": map[string]interface{}{"aws:RequestTag/elbv2.k8s.aws/cluster": "false"},
+				},
+			},
+			{
+				Actions: []string{
+					"elasticloadbalancing:CreateListener",
+					"elasticloadbalancing:DeleteListener",
+					"elasticloadbalancing:CreateRule",
+					"elasticloadbalancing:DeleteRule",
+				},
+				Resources: []string{"*"},
+			},
+			{
+				Actions: []string{
+					"elasticloadbalancing:AddTags",
+					"elasticloadbalancing:RemoveTags",
+				},
+				Resources: loadBalancersAndTargetGroups,
+				Conditions: map[string]interface{}{
+					"Null": map[string]interface{}{
+						"aws:RequestTag/elbv2.k8s.aws/cluster":  "true",
+						"aws:ResourceTag/elbv2.k8s.aws/cluster": "false",
+					},
+				},
+			},
+			{
+				Actions: []string{
+					"elasticloadbalancing:AddTags",
+					"elasticloadbalancing:RemoveTags",
+				},
+				Resources: []string{
+					iamArn("elasticloadbalancing", "listener/net/*/*/*"),
+					iamArn("elasticloadbalancing", "listener/app/*/*/*"),
+					iamArn("elasticloadbalancing", "listener-rule/net/*/*/*"),
+					iamArn("elasticloadbalancing", "listener-rule/app/*/*/*"),
+				},
+			},
+			{
+				Actions: []string{
+					"elasticloadbalancing:ModifyLoadBalancerAttributes",
+					"elasticloadbalancing:SetIpAddressType",
+					"elasticloadbalancing:SetSecurityGroups",
+					"elasticloadbalancing:SetSubnets",
+					"elasticloadbalancing:DeleteLoadBalancer",
+					"elasticloadbalancing:ModifyTargetGroup",
+					"elasticloadbalancing:ModifyTargetGroupAttributes",
+					"elasticloadbalancing:DeleteTargetGroup",
+					"elasticloadbalancing:ModifyListenerAttributes",
+					"elasticloadbalancing:ModifyCapacityReservation",
+				},
+				Resources: []string{"*"},
+				Conditions: map[string]interface{}{
+					"Null": map[string]interface{}{"aws:ResourceTag/elbv2.k8s.aws/cluster": "false"},
+				},
+			},
+			{
+				Actions:   []string{"elasticloadbalancing:AddTags"},
+				Resources: loadBalancersAndTargetGroups,
+				Conditions: map[string]interface{}{
+					"StringEquals": map[string]interface{}{"elasticloadbalancing:CreateAction": []string{"CreateTargetGroup", "CreateLoadBalancer"}},
+					"Null":         map[string]interface{}{"aws:RequestTag/elbv2.k8s.aws/cluster": "false"},
+				},
+			},
+			{
+				Actions: []string{
+					"elasticloadbalancing:RegisterTargets",
+					"elasticloadbalancing:DeregisterTargets",
+				},
+				Resources: []string{iamArn("elasticloadbalancing", "targetgroup/*/*")},
+			},
+			{
+				Actions: []string{
+					"elasticloadbalancing:SetWebAcl",
+					"elasticloadbalancing:ModifyListener",
+					"elasticloadbalancing:AddListenerCertificates",
+					"elasticloadbalancing:RemoveListenerCertificates",
+					"elasticloadbalancing:ModifyRule",
+				},
+				Resources: []string{"*"},
+			},
+		},
+	}
+}
@@ -0,0 +1,263 @@
+package taloscdk
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-cdk-go/awscdk"
+	"github.com/aws/aws-cdk-go/awscdk/awsec2"
+	"github.com/aws/aws-cdk-go/awscdk/awsevents"
+	"github.com/aws/aws-cdk-go/awscdk/awseventstargets"
+	"github.com/aws/aws-cdk-go/awscdk/awsiam"
+	"github.com/aws/aws-cdk-go/awscdk/awslambdago"
+	"github.com/aws/aws-cdk-go/awscdk/awssecretsmanager"
+	"github.com/aws/constructs-go/constructs/v3"
+	"github.com/aws/jsii-runtime-go"
+)
+
+// ImageMirrorRegistry is an upstream registry cached by an ECR pull-through cache rule
+type ImageMirrorRegistry struct {
+	// Host of the registry as written in image references, e.g. registry.k8s.io
+	Host string
+
+	// UpstreamRegistryURL the cache rule pulls from
+	// Default: Host (registry-1.docker.io for docker.io)
+	UpstreamRegistryURL *string
+
+	// RepositoryPrefix of the cached repositories in ECR
+	// Default: Host with dots replaced by dashes, e.g. registry-k8s-io
+	RepositoryPrefix *string
+
+	// Credential for upstreams that require authentication, such as ghcr.io and docker.io.
+	// The secret name must start with ecr-pullthroughcache/ and contain {"username": "...", "accessToken": "..."}
+	// Default: nil
+	Credential awssecretsmanager.ISecret
+}
+
+type ImageMirrorProps struct {
+	// Registries to cache in ECR
+	// Default: registry.k8s.io, public.ecr.aws and quay.io
+	Registries []ImageMirrorRegistry
+
+	// GitHubCredential adds ghcr.io (used by Talos for its own images) to Registries.
+	// See ImageMirrorRegistry.Credential for the secret format.
+	// Default: nil (ghcr.io is not mirrored)
+	GitHubCredential awssecretsmanager.ISecret
+
+	// DockerHubCredential adds docker.io to Registries.
+	// See ImageMirrorRegistry.Credential for the secret format.
+	// Default: nil (docker.io is not mirrored)
+	DockerHubCredential awssecretsmanager.ISecret
+
+	// CacheRules creates the pull-through cache rules. Prefixes are unique per account and region, set it to
+	// false for every ImageMirror but one when several clusters share an account and region.
+	// Default: jsii.Bool(true)
+	CacheRules *bool
+
+	// ClusterName of the nodes that get their ECR credentials refreshed
+	// Default: talos
+	ClusterName *string
+
+	// TalosconfigSecret is a Secrets Manager secret containing a talosconfig for the cluster.
+	// ECR doesn't allow anonymous pulls, so a Lambda in TalosAPIFunctionSubnets patches an ECR token into
+	// machine.registries.config of every node that doesn't have the current one. The token is renewed a
+	// few times a day and kept in a secret in between. It is stored in the machine config of every node,
+	// where it is valid for 12 hours.
+	// Requires Talos v1.0 or later on the nodes, the function reads and applies their config through the
+	// Talos API. Without it, nodes can't authenticate to ECR and pull from the upstream registries instead.
+	// Default: nil
+	TalosconfigSecret awssecretsmanager.ISecret
+
+	// Vpc of the cluster. Required with TalosconfigSecret.
+	Vpc awsec2.IVpc
+
+	// TalosAPIFunctionSubnets are the subnets for Lambda functions that call the Talos API.
+	// They need a route to AWS APIs, through a NAT gateway or VPC endpoints.
+	// Default: &awsec2.SubnetSelection{SubnetType: awsec2.SubnetType_PRIVATE}
+	TalosAPIFunctionSubnets *awsec2.SubnetSelection
+
+	// RefreshInterval is how often the nodes are checked for the current ECR token. New nodes pull from
+	// the upstream registries until the next check. Nodes that have the token aren't changed.
+	// Default: awscdk.Duration_Minutes(jsii.Number(10))
+	RefreshInterval awscdk.Duration
+}
+
+type ImageMirror struct {
+	constructs.Construct
+
+	// RegistryHost of the account's ECR, <account>.dkr.ecr.<region>.<url suffix>
+	RegistryHost *string
+
+	// Registries mirrored, with their defaults filled in
+	Registries []ImageMirrorRegistry
+
+	// ConfigPatch points machine.registries.mirrors at ECR. ControlPlaneProps.ImageMirror and
+	// WorkerASGProps.ImageMirror apply it, apply it with taloscdk.PatchConfig for other nodes.
+	ConfigPatch map[string]interface{}
+
+	// RefreshFunction keeps the ECR credentials of the nodes fresh (if TalosconfigSecret was given)
+	RefreshFunction awslambdago.GoFunction
+}
+
+// NewImageMirror creates ECR pull-through cache rules for the registries used by Talos and the cluster,
+// and returns a config patch that mirrors them through the account's ECR. Nodes fall back to the upstream
+// registries if ECR is unavailable.
+//
+// Example:
+//
+//	mirror := taloscdk.NewImageMirror(stack, jsii.String("ImageMirror"), &taloscdk.ImageMirrorProps{
+//		Vpc:               vpc,
+//		TalosconfigSecret: secrets.Talosconfig,
+//	})
+//	cp := taloscdk.NewControlPlane(stack, jsii.String("CP"), &taloscdk.ControlPlaneProps{
+//		ImageMirror: &mirror,
+//		...
+//	})
+func NewImageMirror(scope constructs.Construct, id *string, props *ImageMirrorProps) ImageMirror {
+	construct := awscdk.NewConstruct(scope, jsii.String(*id))
+
+	if props.Registries == nil {
+		props.Registries = []ImageMirrorRegistry{
+			{Host: "registry.k8s.io"},
+			{Host: "public.ecr.aws"},
+			{Host: "quay.io"},
+		}
+	}
+
+	if props.GitHubCredential != nil {
+		props.Registries = append(props.Registries, ImageMirrorRegistry{Host: "ghcr.io", Credential: props.GitHubCredential})
+	}
+
+	if props.DockerHubCredential != nil {
+		props.Registries = append(props.Registries, ImageMirrorRegistry{Host: "docker.io", Credential: props.DockerHubCredential})
+	}
+
+	if props.CacheRules == nil {
+		props.CacheRules = jsii.Bool(true)
+	}
+
+	if props.ClusterName == nil {
+		props.ClusterName = jsii.String("talos")
+	}
+
+	if props.RefreshInterval == nil {
+		props.RefreshInterval = awscdk.Duration_Minutes(jsii.Number(10))
+	}
+
+	registryHost := jsii.String(fmt.Sprintf("%s.dkr.ecr.%s.%s", *awscdk.Aws_ACCOUNT_ID(), *awscdk.Aws_REGION(), *awscdk.Aws_URL_SUFFIX()))
+
+	mirrors := map[string]interface{}{}
+	for i := range props.Registries {
+		registry := &props.Registries[i]
+
+		if registry.UpstreamRegistryURL == nil {
+			registry.UpstreamRegistryURL = jsii.String(registry.Host)
+			if registry.Host == "docker.io" {
+				registry.UpstreamRegistryURL = jsii.String("registry-1.docker.io")
+			}
+		}
+
+		if registry.RepositoryPrefix == nil {
+			registry.RepositoryPrefix = jsii.String(strings.ReplaceAll(registry.Host, ".", "-"))
+		}
+
+		if *props.CacheRules {
+			properties := map[string]interface{}{
+				"EcrRepositoryPrefix": registry.RepositoryPrefix,
+				"UpstreamRegistryUrl": registry.UpstreamRegistryURL,
+			}
+			if registry.Credential != nil {
+				properties["CredentialArn"] = registry.Credential.SecretArn()
+			}
+
+			awscdk.NewCfnResource(construct, jsii.String("Rule-"+*registry.RepositoryPrefix), &awscdk.CfnResourceProps{
+				Type:       jsii.String("AWS::ECR::PullThroughCacheRule"),
+				Properties: &properties,
+			})
+		}
+
+		mirrors[registry.Host] = map[string]interface{}{
+			"endpoints":    []interface{}{fmt.Sprintf("https://%s/v2/%s", *registryHost, *registry.RepositoryPrefix)},
+			"overridePath": true,
+		}
+	}
+
+	mirror := ImageMirror{
+		Construct:    construct,
+		RegistryHost: registryHost,
+		Registries:   props.Registries,
+		ConfigPatch: map[string]interface{}{
+			"machine": map[string]interface{}{
+				"registries": map[string]interface{}{
+					"mirrors": mirrors,
+				},
+			},
+		},
+	}
+
+	if props.TalosconfigSecret == nil {
+		awscdk.Annotations_Of(construct).AddWarning(jsii.String("ImageMirror without TalosconfigSecret: nodes get no ECR credentials and pull from the upstream registries"))
+		return mirror
+	}
+
+	if props.Vpc == nil {
+		panic("ImageMirror requires a Vpc with TalosconfigSecret")
+	}
+
+	tokenCache := awssecretsmanager.NewSecret(construct, jsii.String("TokenCache"), &awssecretsmanager.SecretProps{
+		Description: jsii.String("Current ECR token of the Talos nodes, managed by the RefreshFunction"),
+	})
+
+	// Nodes pull with tokens of the function's role, so it needs the pull permissions as well
+	fn := newTalosAPIFunction(construct, jsii.String("RefreshFunction"), "registryauth", props.Vpc, props.TalosAPIFunctionSubnets, nil, props.TalosconfigSecret, map[string]*string{
+		"CLUSTER_TAG":            jsii.String(fmt.Sprintf("kubernetes.io/cluster/%s", *props.ClusterName)),
+		"TOKEN_CACHE_SECRET_ARN": tokenCache.SecretArn(),
+		"REFRESH_INTERVAL":       jsii.String(fmt.Sprintf("%.0f", *props.RefreshInterval.ToSeconds(nil))),
+	}, nil)
+	mirror.GrantPull(fn.Role())
+	tokenCache.GrantRead(fn, nil)
+	tokenCache.GrantWrite(fn)
+
+	fn.AddToRolePolicy(awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
+		Effect:    awsiam.Effect_ALLOW,
+		Actions:   jsii.Strings("ec2:DescribeInstances"),
+		Resources: jsii.Strings("*"),
+	}))
+
+	awsevents.NewRule(construct, jsii.String("RefreshSchedule"), &awsevents.RuleProps{
+		Description: jsii.String("Keeps the ECR credentials of Talos nodes current"),
+		Schedule:    awsevents.Schedule_Rate(props.RefreshInterval),
+		Targets:     &[]awsevents.IRuleTarget{awseventstargets.NewLambdaFunction(fn, nil)},
+	})
+
+	mirror.RefreshFunction = fn
+	return mirror
+}
+
+// GrantPull allows role to pull images from ECR, including through the mirror's pull-through cache rules
+func (m *ImageMirror) GrantPull(role awsiam.IRole) {
+	var prefixes []string
+	for _, registry := range m.Registries {
+		prefixes = append(prefixes, *registry.RepositoryPrefix)
+	}
+
+	NewIAMPolicyBuilder(ECRPullPolicyModule(), ECRPullThroughCachePolicyModule(prefixes)).Grant(role)
+}
+
+// checkImage panics if nodes booting the image named imageName can't get their credentials refreshed.
+// The RefreshFunction reads the machine config through the Talos API, which needs Talos v1.0 or later.
+func (m *ImageMirror) checkImage(ami *map[string]*string, imageName *string) {
+	if m.RefreshFunction != nil {
+		requireTalosV1("ImageMirror with TalosconfigSecret", ami, imageName)
+	}
+}
+
+// AddNodes grants the nodes' role pull permissions and allows RefreshFunction to reach their Talos API.
+// Their config still needs ConfigPatch.
+func (m *ImageMirror) AddNodes(role awsiam.IRole, sg awsec2.SecurityGroup) {
+	m.GrantPull(role)
+
+	if m.RefreshFunction != nil {
+		allowTalosAPI(m.RefreshFunction, "registryauth", sg)
+	}
+}
@@ -0,0 +1,435 @@
+package taloscdk
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+
+	"github.com/aws/aws-cdk-go/awscdk"
+	"github.com/aws/aws-cdk-go/awscdk/awsec2"
+	"github.com/aws/aws-cdk-go/awscdk/awsevents"
+	"github.com/aws/aws-cdk-go/awscdk/awseventstargets"
+	"github.com/aws/aws-cdk-go/awscdk/awsiam"
+	"github.com/aws/aws-cdk-go/awscdk/awssecretsmanager"
+	"github.com/aws/aws-cdk-go/awscdk/awssqs"
+	"github.com/aws/constructs-go/constructs/v3"
+	"github.com/aws/jsii-runtime-go"
+	"gopkg.in/yaml.v3"
+)
+
+type KarpenterSupportProps struct {
+	// ClusterName is used for tagging all resources with kubernetes.io/cluster/<name>=owned
+	// and scoping the controller permissions to instances Karpenter launched for the cluster.
+	// Karpenter tags what it launches from its settings.clusterName, which has to equal ClusterName.
+	// Default: talos
+	ClusterName *string
+
+	// TalosNodeConfig is a *string of the worker config (join.yaml) you've generated with
+	// `talosctl gen config <clusterName> <endpoint>`. It becomes the user data of the EC2NodeClass.
+	// TalosNodeConfig is required
+	TalosNodeConfig *string
+
+	// TransformConfig sets whether or not to change the endpoint in our TalosNodeConfig to
+	// the OverwriteValue
+	// Default: jsii.Bool(true)
+	TransformConfig *bool
+
+	// EndpointToOverwrite  is the <endpoint> you used when running `talosctl gen config <clusterName> https://<endpoint>:6443`
+	EndpointToOverwrite *string
+
+	// OverwriteValue to replace EndpointToOverwrite, typically the control plane NLB DNS name.
+	// Required if TransformConfig==true
+	OverwriteValue *string
+
+	// MachineImageName selects the Talos AMI by name (Talos' account is added as owner).
+	// Default: talos-v0.11.2-*-amd64
+	MachineImageName *string
+
+	// MachineImageAMI is used to get the image from an AMI per region.
+	// Defaults to using MachineImageName
+	MachineImageAMI *map[string]*string
+
+	// SecurityGroup of the nodes.
+	// Default: Generates a new security group, opening port 6443 to any peer. The Talos API (50000, 50001)
+	// is not opened, create the group with SecurityGroupProps.TalosAPIPeers to use talosctl from outside of it
+	SecurityGroup awsec2.ISecurityGroup
+
+	// Vpc the nodes are launched into.
+	// Vpc is required and stack will panic if not given.
+	Vpc awsec2.IVpc
+
+	// Subnets the nodes are launched into
+	// Default: &awsec2.SubnetSelection{SubnetType: awsec2.SubnetType_PUBLIC}
+	SubnetSelection *awsec2.SubnetSelection
+
+	// NodeRole of the instances Karpenter launches.
+	// Default: NewWorkerIAMRole()
+	NodeRole awsiam.IRole
+
+	// NodeRoleProps configure the default NodeRole (permissions boundary, path, managed policies, name prefix).
+	// Ignored if NodeRole is set.
+	// Default: nil
+	NodeRoleProps *IAMRoleProps
+
+	// ControllerRoles get the Karpenter controller policy attached, e.g. the control plane role when
+	// the controller runs on the control plane nodes.
+	// Default: nil (attach ControllerPolicy yourself)
+	ControllerRoles []awsiam.IRole
+
+	// NodeClassName is the name of the EC2NodeClass
+	// Default: talos
+	NodeClassName *string
+}
+
+type KarpenterSupport struct {
+	constructs.Construct
+	NodeRole         awsiam.IRole
+	InstanceProfile  awsiam.CfnInstanceProfile
+	ControllerPolicy awsiam.ManagedPolicy
+
+	// InterruptionQueue receives spot interruption, rebalance, instance state and health events.
+	// Pass its name to Karpenter with settings.interruptionQueue.
+	InterruptionQueue awssqs.Queue
+
+	// NodeClassManifest is the EC2NodeClass with the worker config as user data. It contains
+	// CloudFormation tokens (and the cluster join secrets), NodeClassSecret holds the resolved manifest.
+	NodeClassManifest *string
+
+	// NodeClassSecret holds NodeClassManifest, for pipelines to `kubectl apply`
+	NodeClassSecret awssecretsmanager.ISecret
+}
+
+// ec2NodeClassManifest is a Karpenter v1 EC2NodeClass for Talos nodes
+var ec2NodeClassManifest = template.Must(template.New("ec2nodeclass").Parse(`apiVersion: karpenter.k8s.aws/v1
+kind: EC2NodeClass
+metadata:
+  name: {{ .Name }}
+spec:
+  amiFamily: Custom
+  amiSelectorTerms:
+{{- range .AMISelectorTerms }}
+    - {{ . }}
+{{- end }}
+  instanceProfile: {{ .InstanceProfile }}
+  subnetSelectorTerms:
+{{- range .Subnets }}
+    - id: {{ . }}
+{{- end }}
+  securityGroupSelectorTerms:
+    - id: {{ .SecurityGroup }}
+  userData: {{ .UserData }}
+`))
+
+// NewKarpenterSupport creates what Karpenter needs to launch Talos workers: the node role and instance profile,
+// the controller IAM policy, the interruption queue with its EventBridge rules and an EC2NodeClass manifest
+// carrying the worker config.
+// Required KarpenterSupportProps: Vpc, TalosNodeConfig, EndpointToOverwrite and OverwriteValue (if TransformConfig==true)
+func NewKarpenterSupport(scope constructs.Construct, id *string, props *KarpenterSupportProps) KarpenterSupport {
+	construct := awscdk.NewConstruct(scope, jsii.String(*id))
+
+	if props.ClusterName == nil {
+		props.ClusterName = jsii.String("talos")
+	}
+
+	if props.Vpc == nil {
+		panic("Vpc is required")
+	}
+
+	if props.TalosNodeConfig == nil {
+		panic("TalosNodeConfig cannot be nil. taloscdk.LoadConfig() can be used to load the needed file.")
+	}
+
+	if props.TransformConfig == nil {
+		props.TransformConfig = jsii.Bool(true)
+	}
+
+	if *props.TransformConfig {
+		if props.EndpointToOverwrite == nil || props.OverwriteValue == nil {
+			panic("Requested config transform but missing EndpointToOverwrite or OverwriteValue.")
+		}
+		props.TalosNodeConfig = TransformConfig(props.TalosNodeConfig, *props.EndpointToOverwrite, *props.OverwriteValue)
+	}
+
+	if props.MachineImageName == nil && props.MachineImageAMI == nil {
+		props.MachineImageName = jsii.String("talos-v0.11.2-*-amd64")
+	}
+
+	if props.SecurityGroup == nil {
+		props.SecurityGroup = NewSecurityGroup(construct, jsii.String("TalosSG"), &SecurityGroupProps{
+			Vpc: props.Vpc,
+		})
+	}
+
+	if props.SubnetSelection == nil {
+		props.SubnetSelection = &awsec2.SubnetSelection{SubnetType: awsec2.SubnetType_PUBLIC}
+	}
+
+	if props.NodeRole == nil {
+		props.NodeRole = NewWorkerIAMRole(construct, jsii.String("NodeRole"), props.NodeRoleProps)
+	}
+
+	if props.NodeClassName == nil {
+		props.NodeClassName = jsii.String("talos")
+	}
+
+	instanceProfile := awsiam.NewCfnInstanceProfile(construct, jsii.String("InstanceProfile"), &awsiam.CfnInstanceProfileProps{
+		Roles: &[]*string{props.NodeRole.RoleName()},
+	})
+
+	queue := awssqs.NewQueue(construct, jsii.String("InterruptionQueue"), &awssqs.QueueProps{
+		RetentionPeriod: awscdk.Duration_Minutes(jsii.Number(5)),
+		Encryption:      awssqs.QueueEncryption_KMS,
+	})
+	addInterruptionRules(construct, queue)
+
+	policy := awsiam.NewManagedPolicy(construct, jsii.String("ControllerPolicy"), &awsiam.ManagedPolicyProps{
+		Description: jsii.String(fmt.Sprintf("Karpenter controller for Talos cluster %s", *props.ClusterName)),
+		Document:    newKarpenterControllerPolicyDocument(construct, *props.ClusterName, props.NodeRole, queue),
+	})
+	for _, role := range props.ControllerRoles {
+		policy.AttachToRole(role)
+	}
+
+	manifest := newEC2NodeClassManifest(construct, props, instanceProfile)
+
+	secret := awssecretsmanager.NewCfnSecret(construct, jsii.String("NodeClass"), &awssecretsmanager.CfnSecretProps{
+		Description:  jsii.String("Karpenter EC2NodeClass for Talos workers"),
+		SecretString: manifest,
+	})
+
+	awscdk.Tags_Of(construct).Add(jsii.String(fmt.Sprintf("kubernetes.io/cluster/%s", *props.ClusterName)), jsii.String("owned"), nil)
+
+	return KarpenterSupport{
+		Construct:         construct,
+		NodeRole:          props.NodeRole,
+		InstanceProfile:   instanceProfile,
+		ControllerPolicy:  policy,
+		InterruptionQueue: queue,
+		NodeClassManifest: manifest,
+		NodeClassSecret:   awssecretsmanager.Secret_FromSecretCompleteArn(construct, jsii.String("NodeClassRef"), secret.Ref()),
+	}
+}
+
+// addInterruptionRules forwards the events Karpenter handles to queue
+func addInterruptionRules(scope awscdk.Construct, queue awssqs.Queue) {
+	rules := []struct {
+		id, source, detailType string
+	}{
+		{"ScheduledChangeRule", "aws.health", "AWS Health Event"},
+		{"SpotInterruptionRule", "aws.ec2", "EC2 Spot Instance Interruption Warning"},
+		{"RebalanceRule", "aws.ec2", "EC2 Instance Rebalance Recommendation"},
+		{"InstanceStateChangeRule", "aws.ec2", "EC2 Instance State-change Notification"},
+	}
+
+	for _, rule := range rules {
+		awsevents.NewRule(scope, jsii.String(rule.id), &awsevents.RuleProps{
+			EventPattern: &awsevents.EventPattern{
+				Source:     jsii.Strings(rule.source),
+				DetailType: jsii.Strings(rule.detailType),
+			},
+			Targets: &[]awsevents.IRuleTarget{awseventstargets.NewSqsQueue(queue, nil)},
+		})
+	}
+}
+
+// newKarpenterControllerPolicyDocument follows the controller policy of the Karpenter getting started guide.
+// Mutating actions are limited to resources tagged for the cluster and a Karpenter node pool.
+func newKarpenterControllerPolicyDocument(scope awscdk.Construct, clusterName string, nodeRole awsiam.IRole, queue awssqs.Queue) awsiam.PolicyDocument {
+	stack := awscdk.Stack_Of(scope)
+	clusterTag := fmt.Sprintf("kubernetes.io/cluster/%s", clusterName)
+
+	ec2Arn := func(resource string) *string {
+		return stack.FormatArn(&awscdk.ArnComponents{
+			Service:      jsii.String("ec2"),
+			Resource:     jsii.String(resource),
+			ResourceName: jsii.String("*"),
+		})
+	}
+
+	return awsiam.NewPolicyDocument(&awsiam.PolicyDocumentProps{
+		Statements: &[]awsiam.PolicyStatement{
+			awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
+				Sid:     jsii.String("AllowScopedEC2InstanceAccessActions"),
+				Effect:  awsiam.Effect_ALLOW,
+				Actions: jsii.Strings("ec2:RunInstances", "ec2:CreateFleet"),
+				Resources: &[]*string{
+					stack.FormatArn(&awscdk.ArnComponents{Service: jsii.String("ec2"), Account: jsii.String(""), Resource: jsii.String("image"), ResourceName: jsii.String("*")}),
+					stack.FormatArn(&awscdk.ArnComponents{Service: jsii.String("ec2"), Account: jsii.String(""), Resource: jsii.String("snapshot"), ResourceName: jsii.String("*")}),
+					ec2Arn("security-group"),
+					ec2Arn("subnet"),
+					ec2Arn("capacity-reservation"),
+				},
+			}),
+			awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
+				Sid:       jsii.String("AllowScopedEC2LaunchTemplateAccessActions"),
+				Effect:    awsiam.Effect_ALLOW,
+				Actions:   jsii.Strings("ec2:RunInstances", "ec2:CreateFleet"),
+				Resources: &[]*string{ec2Arn("launch-template")},
+				Conditions: &map[string]interface{}{
+					"StringEquals": map[string]interface{}{"aws:ResourceTag/" + clusterTag: "owned"},
+					"StringLike":   map[string]interface{}{"aws:ResourceTag/karpenter.sh/nodepool": "*"},
+				},
+			}),
+			awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
+				Sid:     jsii.String("AllowScopedEC2InstanceActionsWithTags"),
+				Effect:  awsiam.Effect_ALLOW,
+				Actions: jsii.Strings("ec2:RunInstances", "ec2:CreateFleet", "ec2:CreateLaunchTemplate"),
+				Resources: &[]*string{
+					ec2Arn("fleet"),
+					ec2Arn("instance"),
+					ec2Arn("volume"),
+					ec2Arn("network-interface"),
+					ec2Arn("launch-template"),
+					ec2Arn("spot-instances-request"),
+				},
+				Conditions: &map[string]interface{}{
+					"StringEquals": map[string]interface{}{"aws:RequestTag/" + clusterTag: "owned"},
+					"StringLike":   map[string]interface{}{"aws:RequestTag/karpenter.sh/nodepool": "*"},
+				},
+			}),
+			awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
+				Sid:     jsii.String("AllowScopedResourceCreationTagging"),
+				Effect:  awsiam.Effect_ALLOW,
+				Actions: jsii.Strings("ec2:CreateTags"),
+				Resources: &[]*string{
+					ec2Arn("fleet"),
+					ec2Arn("instance"),
+					ec2Arn("volume"),
+					ec2Arn("network-interface"),
+					ec2Arn("launch-template"),
+					ec2Arn("spot-instances-request"),
+				},
+				Conditions: &map[string]interface{}{
+					"StringEquals": map[string]interface{}{
+						"aws:RequestTag/" + clusterTag: "owned",
+						"ec2:CreateAction":             []string{"RunInstances", "CreateFleet", "CreateLaunchTemplate"},
+					},
+					"StringLike": map[string]interface{}{"aws:RequestTag/karpenter.sh/nodepool": "*"},
+				},
+			}),
+			awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
+				Sid:       jsii.String("AllowScopedResourceTagging"),
+				Effect:    awsiam.Effect_ALLOW,
+				Actions:   jsii.Strings("ec2:CreateTags"),
+				Resources: &[]*string{ec2Arn("instance")},
+				Conditions: &map[string]interface{}{
+					"StringEquals": map[string]interface{}{"aws:ResourceTag/" + clusterTag: "owned"},
+					"StringLike":   map[string]interface{}{"aws:ResourceTag/karpenter.sh/nodepool": "*"},
+					"ForAllValues:StringEquals": map[string]interface{}{
+						"aws:TagKeys": []string{"eks:eks-cluster-name", "karpenter.sh/nodeclaim", "Name"},
+					},
+				},
+			}),
+			awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
+				Sid:       jsii.String("AllowScopedDeletion"),
+				Effect:    awsiam.Effect_ALLOW,
+				Actions:   jsii.Strings("ec2:TerminateInstances", "ec2:DeleteLaunchTemplate"),
+				Resources: &[]*string{ec2Arn("instance"), ec2Arn("launch-template")},
+				Conditions: &map[string]interface{}{
+					"StringEquals": map[string]interface{}{"aws:ResourceTag/" + clusterTag: "owned"},
+					"StringLike":   map[string]interface{}{"aws:ResourceTag/karpenter.sh/nodepool": "*"},
+				},
+			}),
+			awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
+				Sid:    jsii.String("AllowRegionalReadActions"),
+				Effect: awsiam.Effect_ALLOW,
+				Actions: jsii.Strings(
+					"ec2:DescribeCapacityReservations",
+					"ec2:DescribeImages",
+					"ec2:DescribeInstances",
+					"ec2:DescribeInstanceTypeOfferings",
+					"ec2:DescribeInstanceTypes",
+					"ec2:DescribeLaunchTemplates",
+					"ec2:DescribeSecurityGroups",
+					"ec2:DescribeSpotPriceHistory",
+					"ec2:DescribeSubnets",
+				),
+				Resources: jsii.Strings("*"),
+				Conditions: &map[string]interface{}{
+					"StringEquals": map[string]interface{}{"aws:RequestedRegion": stack.Region()},
+				},
+			}),
+			awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
+				Sid:     jsii.String("AllowSSMReadActions"),
+				Effect:  awsiam.Effect_ALLOW,
+				Actions: jsii.Strings("ssm:GetParameter"),
+				Resources: &[]*string{stack.FormatArn(&awscdk.ArnComponents{
+					Service:      jsii.String("ssm"),
+					Account:      jsii.String(""),
+					Resource:     jsii.String("parameter"),
+					ResourceName: jsii.String("aws/service/*"),
+				})},
+			}),
+			awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
+				Sid:       jsii.String("AllowPricingReadActions"),
+				Effect:    awsiam.Effect_ALLOW,
+				Actions:   jsii.Strings("pricing:GetProducts"),
+				Resources: jsii.Strings("*"),
+			}),
+			awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
+				Sid:       jsii.String("AllowInterruptionQueueActions"),
+				Effect:    awsiam.Effect_ALLOW,
+				Actions:   jsii.Strings("sqs:DeleteMessage", "sqs:GetQueueUrl", "sqs:ReceiveMessage"),
+				Resources: &[]*string{queue.QueueArn()},
+			}),
+			awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
+				Sid:       jsii.String("AllowInterruptionQueueDecrypt"),
+				Effect:    awsiam.Effect_ALLOW,
+				Actions:   jsii.Strings("kms:Decrypt"),
+				Resources: &[]*string{queue.EncryptionMasterKey().KeyArn()},
+			}),
+			awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
+				Sid:       jsii.String("AllowPassingInstanceRole"),
+				Effect:    awsiam.Effect_ALLOW,
+				Actions:   jsii.Strings("iam:PassRole"),
+				Resources: &[]*string{nodeRole.RoleArn()},
+				Conditions: &map[string]interface{}{
+					"StringEquals": map[string]interface{}{"iam:PassedToService": "ec2.amazonaws.com"},
+				},
+			}),
+			awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
+				Sid:       jsii.String("AllowInstanceProfileReadActions"),
+				Effect:    awsiam.Effect_ALLOW,
+				Actions:   jsii.Strings("iam:GetInstanceProfile"),
+				Resources: jsii.Strings("*"),
+			}),
+		},
+	})
+}
+
+// newEC2NodeClassManifest renders the EC2NodeClass for the props
+func newEC2NodeClassManifest(scope awscdk.Construct, props *KarpenterSupportProps, instanceProfile awsiam.CfnInstanceProfile) *string {
+	var amiSelectorTerms []string
+	if props.MachineImageAMI != nil {
+		image := awsec2.NewGenericLinuxImage(props.MachineImageAMI, nil).GetImage(scope)
+		amiSelectorTerms = append(amiSelectorTerms, "id: "+*image.ImageId)
+	} else {
+		amiSelectorTerms = append(amiSelectorTerms, fmt.Sprintf("name: %q\n      owner: \"540036508848\"", *props.MachineImageName))
+	}
+
+	var subnets []string
+	for _, subnet := range *props.Vpc.SelectSubnets(props.SubnetSelection).Subnets {
+		subnets = append(subnets, *subnet.SubnetId())
+	}
+
+	// The config is embedded as a YAML string, so its indentation can't break the manifest
+	userData, err := yaml.Marshal(*props.TalosNodeConfig)
+	if err != nil {
+		panic(fmt.Sprintf("Could not encode worker config: %v", err))
+	}
+
+	var manifest bytes.Buffer
+	err = ec2NodeClassManifest.Execute(&manifest, map[string]interface{}{
+		"Name":             *props.NodeClassName,
+		"AMISelectorTerms": amiSelectorTerms,
+		"InstanceProfile":  *instanceProfile.Ref(),
+		"Subnets":          subnets,
+		"SecurityGroup":    *props.SecurityGroup.SecurityGroupId(),
+		"UserData":         string(bytes.TrimRight(userData, "\n")),
+	})
+	if err != nil {
+		panic(fmt.Sprintf("Could not render EC2NodeClass manifest: %v", err))
+	}
+
+	return jsii.String(manifest.String())
+}
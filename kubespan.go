@@ -0,0 +1,81 @@
+package taloscdk
+
+import (
+	"github.com/aws/aws-cdk-go/awscdk/awsec2"
+	"github.com/aws/jsii-runtime-go"
+)
+
+// kubeSpanPort is the WireGuard port KubeSpan listens on
+const kubeSpanPort = 51820
+
+type KubeSpanProps struct {
+	// AdvertiseKubernetesNetworks routes pod traffic between nodes through KubeSpan as well
+	// Default: jsii.Bool(false)
+	AdvertiseKubernetesNetworks *bool
+
+	// Peers outside of the cluster's security groups that may connect to KubeSpan, e.g. nodes in other VPCs or clouds.
+	// Nodes find each other through the discovery service, which needs HTTPS egress to discovery.talos.dev.
+	// Default: nil (only nodes in the security groups)
+	Peers []awsec2.IPeer
+
+	// NodeSecurityGroups are the groups of the cluster's other nodes, e.g. the control plane's SecurityGroup when
+	// the workers get a default security group of their own. The port is opened both ways.
+	// Default: nil (only nodes in the same security group, or all ClusterSecurityGroups)
+	NodeSecurityGroups []awsec2.ISecurityGroup
+}
+
+// KubeSpanConfigPatch returns a config patch that enables KubeSpan and cluster discovery, which KubeSpan
+// uses to find its peers. Apply it to the control plane and worker configs.
+func KubeSpanConfigPatch(props *KubeSpanProps) map[string]interface{} {
+	if props == nil {
+		props = &KubeSpanProps{}
+	}
+
+	if props.AdvertiseKubernetesNetworks == nil {
+		props.AdvertiseKubernetesNetworks = jsii.Bool(false)
+	}
+
+	return map[string]interface{}{
+		"machine": map[string]interface{}{
+			"network": map[string]interface{}{
+				"kubespan": map[string]interface{}{
+					"enabled":                     true,
+					"advertiseKubernetesNetworks": *props.AdvertiseKubernetesNetworks,
+				},
+			},
+		},
+		"cluster": map[string]interface{}{
+			"discovery": map[string]interface{}{
+				"enabled": true,
+			},
+		},
+	}
+}
+
+// addKubeSpanRules opens the KubeSpan WireGuard port of sg to the nodes in clusterSGs and props.Peers, and
+// between sg and props.NodeSecurityGroups
+func addKubeSpanRules(sg awsec2.SecurityGroup, props *KubeSpanProps, clusterSGs ...awsec2.ISecurityGroup) {
+	port := awsec2.Port_Udp(jsii.Number(kubeSpanPort))
+
+	for _, peer := range clusterSGs {
+		sg.AddIngressRule(peer, port, jsii.String("KubeSpan from cluster nodes"), jsii.Bool(false))
+	}
+
+	for _, peer := range props.NodeSecurityGroups {
+		sg.AddIngressRule(peer, port, jsii.String("KubeSpan from cluster nodes"), jsii.Bool(false))
+		peer.AddIngressRule(sg, port, jsii.String("KubeSpan from cluster nodes"), jsii.Bool(false))
+		if !*sg.AllowAllOutbound() {
+			sg.AddEgressRule(peer, port, jsii.String("KubeSpan to cluster nodes"), jsii.Bool(false))
+		}
+		if !*peer.AllowAllOutbound() {
+			peer.AddEgressRule(sg, port, jsii.String("KubeSpan to cluster nodes"), jsii.Bool(false))
+		}
+	}
+
+	for _, peer := range props.Peers {
+		sg.AddIngressRule(peer, port, jsii.String("KubeSpan"), jsii.Bool(false))
+		if !*sg.AllowAllOutbound() {
+			sg.AddEgressRule(peer, port, jsii.String("KubeSpan"), jsii.Bool(false))
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package taloscdk
+
+import (
+	"path/filepath"
+	"runtime"
+
+	"github.com/aws/aws-cdk-go/awscdk"
+	"github.com/aws/aws-cdk-go/awscdk/awsautoscaling"
+	"github.com/aws/aws-cdk-go/awscdk/awsautoscalinghooktargets"
+	"github.com/aws/aws-cdk-go/awscdk/awsec2"
+	"github.com/aws/aws-cdk-go/awscdk/awslambda"
+	"github.com/aws/aws-cdk-go/awscdk/awslambdago"
+	"github.com/aws/aws-cdk-go/awscdk/awssecretsmanager"
+	"github.com/aws/aws-cdk-go/awscdk/awssns"
+	"github.com/aws/aws-cdk-go/awscdk/awssnssubscriptions"
+	"github.com/aws/jsii-runtime-go"
+)
+
+// moduleDir returns the directory of the taloscdk module, which is where the Lambda handlers
+// in ./lambda are built from. This also works when taloscdk is used from the Go module cache.
+func moduleDir() string {
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		panic("Could not determine the taloscdk module directory")
+	}
+	return filepath.Dir(file)
+}
+
+// newHandlerFunction returns a Go Lambda function built from ./lambda/<handler>.
+// Entry, ModuleDir and Runtime are set by this function, all other props are passed through.
+func newHandlerFunction(scope awscdk.Construct, id *string, handler string, props *awslambdago.GoFunctionProps) awslambdago.GoFunction {
+	if props == nil {
+		props = &awslambdago.GoFunctionProps{}
+	}
+
+	props.Entry = jsii.String(filepath.Join(moduleDir(), "lambda", handler))
+	props.ModuleDir = jsii.String(filepath.Join(moduleDir(), "go.mod"))
+	props.Runtime = awslambda.Runtime_PROVIDED_AL2()
+
+	if props.Bundling == nil {
+		props.Bundling = &awslambdago.BundlingOptions{
+			GoBuildFlags: jsii.Strings(`-ldflags "-s -w"`, "-tags lambda.norpc"),
+		}
+	}
+
+	return awslambdago.NewGoFunction(scope, id, props)
+}
+
+// newLifecycleHookTarget returns a hook target that delivers lifecycle notifications to fn through
+// a single SNS topic, so one function can serve the hooks of several autoscaling groups.
+func newLifecycleHookTarget(scope awscdk.Construct, id *string, fn awslambda.IFunction) awsautoscaling.ILifecycleHookTarget {
+	topic := awssns.NewTopic(scope, id, &awssns.TopicProps{})
+	topic.AddSubscription(awssnssubscriptions.NewLambdaSubscription(fn, nil))
+
+	return awsautoscalinghooktargets.NewTopicHook(topic)
+}
+
+// newTalosAPIFunction returns a handler function running in the VPC that can reach the Talos API
+// (50000) of nodes in nodeSG. nodeSG may be nil, other node groups are added with allowTalosAPI().
+// If talosconfig is given, the function can read it and finds its ARN in TALOSCONFIG_SECRET_ARN.
+// subnets need a route to AWS APIs (NAT gateway or VPC endpoints). timeout defaults to 5 minutes.
+func newTalosAPIFunction(scope awscdk.Construct, id *string, handler string, vpc awsec2.IVpc, subnets *awsec2.SubnetSelection, nodeSG awsec2.SecurityGroup, talosconfig awssecretsmanager.ISecret, env map[string]*string, timeout awscdk.Duration) awslambdago.GoFunction {
+	if subnets == nil {
+		subnets = &awsec2.SubnetSelection{SubnetType: awsec2.SubnetType_PRIVATE}
+	}
+
+	if env == nil {
+		env = map[string]*string{}
+	}
+
+	if timeout == nil {
+		timeout = awscdk.Duration_Minutes(jsii.Number(5))
+	}
+
+	if talosconfig != nil {
+		env["TALOSCONFIG_SECRET_ARN"] = talosconfig.SecretArn()
+	}
+
+	sg := awsec2.NewSecurityGroup(scope, jsii.String(*id+"SG"), &awsec2.SecurityGroupProps{
+		Vpc:              vpc,
+		AllowAllOutbound: jsii.Bool(true),
+		Description:      jsii.String("Talos API client Lambda"),
+	})
+
+	if nodeSG != nil {
+		nodeSG.AddIngressRule(sg, awsec2.Port_Tcp(jsii.Number(50000)), jsii.String("Talos API from "+handler+" Lambda"), jsii.Bool(false))
+	}
+
+	fn := newHandlerFunction(scope, id, handler, &awslambdago.GoFunctionProps{
+		Vpc:           vpc,
+		VpcSubnets:    subnets,
+		SecurityGroup: sg,
+		Environment:   &env,
+		Timeout:       timeout,
+	})
+
+	if talosconfig != nil {
+		talosconfig.GrantRead(fn, nil)
+	}
+
+	return fn
+}
+
+// allowTalosAPI allows fn, created by newTalosAPIFunction(), to reach the Talos API of nodes in nodeSG
+func allowTalosAPI(fn awslambdago.GoFunction, handler string, nodeSG awsec2.SecurityGroup) {
+	nodeSG.Connections().AllowFrom(fn, awsec2.Port_Tcp(jsii.Number(50000)), jsii.String("Talos API from "+handler+" Lambda"))
+}
@@ -0,0 +1,292 @@
+// Command bootstrap backs the Custom::TalosBootstrap resource. It is used as both the onEvent and
+// isComplete handler of a custom resource provider. On create, onEvent picks the first control plane
+// node, waits for its Talos API and bootstraps etcd on it exactly once. The node is passed on in Data,
+// and isComplete only polls its etcd service until it is healthy. If requested, the admin kubeconfig
+// is then stored in Secrets Manager.
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	machineapi "github.com/siderolabs/talos/pkg/machinery/api/machine"
+	"github.com/siderolabs/talos/pkg/machinery/client"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"github.com/steveyackey/taloscdk/lambda/internal/nodes"
+	"github.com/steveyackey/taloscdk/lambda/internal/talosapi"
+)
+
+// bootstrapNodeKey is the Data attribute holding the bootstrapped node's endpoint
+const bootstrapNodeKey = "BootstrapNode"
+
+// pollInterval is the wait between checks for an in-service node and its Talos API during create
+const pollInterval = 15 * time.Second
+
+// request is the custom resource provider event. isComplete events carry the Data returned by onEvent.
+type request struct {
+	RequestType        string            `json:"RequestType"`
+	PhysicalResourceID string            `json:"PhysicalResourceId"`
+	ResourceProperties properties        `json:"ResourceProperties"`
+	Data               map[string]string `json:"Data"`
+}
+
+type properties struct {
+	// AutoScalingGroupNames of the control plane, the oldest in-service instance is bootstrapped
+	AutoScalingGroupNames []string `json:"AutoScalingGroupNames"`
+
+	// Endpoints to bootstrap instead of looking up ASG instances (e.g. a single node's IP)
+	Endpoints []string `json:"Endpoints"`
+
+	// KubeconfigSecretArn receives the admin kubeconfig once etcd is healthy
+	KubeconfigSecretArn string `json:"KubeconfigSecretArn"`
+}
+
+// response is understood by both the onEvent and isComplete steps of the provider.
+// isComplete must not return Data while incomplete, the provider passes on the Data of onEvent.
+type response struct {
+	PhysicalResourceID string            `json:"PhysicalResourceId"`
+	IsComplete         bool              `json:"IsComplete"`
+	Data               map[string]string `json:"Data,omitempty"`
+}
+
+// talosClient is the subset of the Talos API used by the handler. *client.Client satisfies it.
+type talosClient interface {
+	Version(ctx context.Context, callOptions ...grpc.CallOption) (*machineapi.VersionResponse, error)
+	ServiceInfo(ctx context.Context, id string, callOptions ...grpc.CallOption) ([]client.ServiceInfo, error)
+	Bootstrap(ctx context.Context, req *machineapi.BootstrapRequest) error
+	Kubeconfig(ctx context.Context) ([]byte, error)
+	Close() error
+}
+
+// secretWriter stores secret values. *secretsmanager.Client satisfies it.
+type secretWriter interface {
+	PutSecretValue(ctx context.Context, params *secretsmanager.PutSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.PutSecretValueOutput, error)
+}
+
+type handler struct {
+	ec2         nodes.EC2
+	autoscaling nodes.AutoScaling
+	secrets     secretWriter
+
+	// connect opens a Talos API client for the given endpoints
+	connect func(ctx context.Context, endpoints []string) (talosClient, error)
+}
+
+func (h *handler) handle(ctx context.Context, req request) (response, error) {
+	resp := response{PhysicalResourceID: req.PhysicalResourceID}
+	if resp.PhysicalResourceID == "" {
+		resp.PhysicalResourceID = "talos-bootstrap"
+	}
+
+	// Bootstrap only ever happens on create, updates and deletes leave the cluster alone
+	if req.RequestType != "Create" {
+		resp.IsComplete = true
+		return resp, nil
+	}
+
+	// onEvent
+	endpoint := req.Data[bootstrapNodeKey]
+	if endpoint == "" {
+		bootstrapped, err := h.create(ctx, req.ResourceProperties)
+		if err != nil {
+			return resp, err
+		}
+		resp.Data = map[string]string{bootstrapNodeKey: bootstrapped}
+		return resp, nil
+	}
+
+	// isComplete
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+
+	healthy, err := h.etcdHealthy(ctx, endpoint)
+	if err != nil {
+		// etcd takes a while to start after the bootstrap, keep polling until the provider times out
+		log.Printf("%s: %v", endpoint, err)
+		return resp, nil
+	}
+
+	if healthy && req.ResourceProperties.KubeconfigSecretArn != "" {
+		if err := h.storeKubeconfig(ctx, endpoint, req.ResourceProperties.KubeconfigSecretArn); err != nil {
+			log.Printf("%s: %v", endpoint, err)
+			return resp, nil
+		}
+	}
+
+	resp.IsComplete = healthy
+	return resp, nil
+}
+
+// create waits for the first control plane node and its Talos API, bootstraps it and returns its endpoint.
+// The node is chosen once, so a node replaced in the meantime never gets bootstrapped into a second cluster.
+func (h *handler) create(ctx context.Context, props properties) (string, error) {
+	// Leave time to report a failure before the function times out
+	if deadline, ok := ctx.Deadline(); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline.Add(-30*time.Second))
+		defer cancel()
+	}
+
+	var endpoint string
+	for {
+		var err error
+		endpoint, err = h.target(ctx, props)
+		if err != nil {
+			return "", err
+		}
+		if endpoint != "" {
+			break
+		}
+
+		log.Print("no control plane node is in service yet")
+		if err := wait(ctx); err != nil {
+			return "", fmt.Errorf("waiting for a control plane node: %w", err)
+		}
+	}
+
+	c, err := h.connect(ctx, []string{endpoint})
+	if err != nil {
+		return "", err
+	}
+	defer c.Close()
+
+	for {
+		_, err := c.Version(ctx)
+		if err == nil {
+			break
+		}
+
+		// Nodes are expected to be unreachable while booting
+		log.Printf("%s: waiting for apid: %v", endpoint, err)
+		if err := wait(ctx); err != nil {
+			return "", fmt.Errorf("waiting for the Talos API on %s: %w", endpoint, err)
+		}
+	}
+
+	err = c.Bootstrap(ctx, &machineapi.BootstrapRequest{})
+	switch {
+	case err == nil:
+		log.Printf("%s: bootstrapped", endpoint)
+	case client.StatusCode(err) == codes.AlreadyExists:
+		log.Printf("%s: already bootstrapped", endpoint)
+	default:
+		return "", fmt.Errorf("bootstrapping %s: %w", endpoint, err)
+	}
+
+	return endpoint, nil
+}
+
+// wait sleeps for pollInterval, or returns the context error if it ends first
+func wait(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(pollInterval):
+		return nil
+	}
+}
+
+// storeKubeconfig writes the admin kubeconfig of the cluster to the secret
+func (h *handler) storeKubeconfig(ctx context.Context, endpoint string, secretARN string) error {
+	c, err := h.connect(ctx, []string{endpoint})
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	kubeconfig, err := c.Kubeconfig(ctx)
+	if err != nil {
+		return fmt.Errorf("getting kubeconfig: %w", err)
+	}
+
+	_, err = h.secrets.PutSecretValue(ctx, &secretsmanager.PutSecretValueInput{
+		SecretId:     aws.String(secretARN),
+		SecretString: aws.String(string(kubeconfig)),
+	})
+	if err != nil {
+		return fmt.Errorf("storing kubeconfig: %w", err)
+	}
+
+	log.Printf("%s: stored kubeconfig in %s", endpoint, secretARN)
+	return nil
+}
+
+// target returns the node to bootstrap, or "" if none is running yet
+func (h *handler) target(ctx context.Context, props properties) (string, error) {
+	if len(props.Endpoints) > 0 {
+		return props.Endpoints[0], nil
+	}
+
+	instances, err := nodes.InService(ctx, h.autoscaling, h.ec2, props.AutoScalingGroupNames)
+	if err != nil {
+		return "", err
+	}
+
+	ips := nodes.PrivateIPs(instances)
+	if len(ips) == 0 {
+		return "", nil
+	}
+	return ips[0], nil
+}
+
+// etcdHealthy reports whether the etcd service of the bootstrapped node is running and healthy
+func (h *handler) etcdHealthy(ctx context.Context, endpoint string) (bool, error) {
+	c, err := h.connect(ctx, []string{endpoint})
+	if err != nil {
+		return false, err
+	}
+	defer c.Close()
+
+	services, err := c.ServiceInfo(ctx, "etcd")
+	if err != nil {
+		return false, fmt.Errorf("getting etcd service status: %w", err)
+	}
+
+	for _, svc := range services {
+		if svc.Service.GetState() == "Running" {
+			healthy := svc.Service.GetHealth().GetHealthy()
+			log.Printf("%s: etcd is running, healthy: %t", endpoint, healthy)
+			return healthy, nil
+		}
+	}
+
+	log.Printf("%s: etcd is not running yet", endpoint)
+	return false, nil
+}
+
+func main() {
+	ctx := context.Background()
+
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		log.Fatalf("loading AWS config: %v", err)
+	}
+
+	sm := secretsmanager.NewFromConfig(cfg)
+
+	talosconfig, err := talosapi.LoadTalosconfig(ctx, sm)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	h := &handler{
+		ec2:         ec2.NewFromConfig(cfg),
+		autoscaling: autoscaling.NewFromConfig(cfg),
+		secrets:     sm,
+		connect: func(ctx context.Context, endpoints []string) (talosClient, error) {
+			return talosapi.Connect(ctx, talosconfig, endpoints)
+		},
+	}
+	lambda.Start(h.handle)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	astypes "github.com/aws/aws-sdk-go-v2/service/autoscaling/types"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	machineapi "github.com/siderolabs/talos/pkg/machinery/api/machine"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/steveyackey/taloscdk/lambda/internal/talostest"
+)
+
+// machineService is a Talos API stand-in of the first control plane node
+type machineService struct {
+	machineapi.UnimplementedMachineServiceServer
+
+	bootstrapErr error
+	etcdState    string
+	etcdHealthy  bool
+
+	bootstraps int
+}
+
+func (s *machineService) Version(context.Context, *emptypb.Empty) (*machineapi.VersionResponse, error) {
+	return &machineapi.VersionResponse{Messages: []*machineapi.Version{{Version: &machineapi.VersionInfo{Tag: "v1.11.0"}}}}, nil
+}
+
+func (s *machineService) Bootstrap(context.Context, *machineapi.BootstrapRequest) (*machineapi.BootstrapResponse, error) {
+	s.bootstraps++
+	if s.bootstrapErr != nil {
+		return nil, s.bootstrapErr
+	}
+	return &machineapi.BootstrapResponse{Messages: []*machineapi.Bootstrap{{}}}, nil
+}
+
+func (s *machineService) ServiceList(context.Context, *emptypb.Empty) (*machineapi.ServiceListResponse, error) {
+	return &machineapi.ServiceListResponse{Messages: []*machineapi.ServiceList{{Services: []*machineapi.ServiceInfo{{
+		Id:     "etcd",
+		State:  s.etcdState,
+		Health: &machineapi.ServiceHealth{Healthy: s.etcdHealthy},
+	}}}}}, nil
+}
+
+// fakeNodes reports i-first as the oldest in-service control plane instance
+type fakeNodes struct{}
+
+func (fakeNodes) DescribeAutoScalingGroups(context.Context, *autoscaling.DescribeAutoScalingGroupsInput, ...func(*autoscaling.Options)) (*autoscaling.DescribeAutoScalingGroupsOutput, error) {
+	return &autoscaling.DescribeAutoScalingGroupsOutput{AutoScalingGroups: []astypes.AutoScalingGroup{{
+		Instances: []astypes.Instance{{InstanceId: aws.String("i-first"), LifecycleState: astypes.LifecycleStateInService}},
+	}}}, nil
+}
+
+func (fakeNodes) DescribeInstances(context.Context, *ec2.DescribeInstancesInput, ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
+	return &ec2.DescribeInstancesOutput{Reservations: []ec2types.Reservation{{Instances: []ec2types.Instance{{
+		InstanceId:       aws.String("i-first"),
+		PrivateIpAddress: aws.String("10.0.1.10"),
+	}}}}}, nil
+}
+
+func newHandler(t *testing.T, srv *machineService) (*handler, *[]string) {
+	path := talostest.Serve(t, srv)
+
+	var connected []string
+	return &handler{
+		ec2:         fakeNodes{},
+		autoscaling: fakeNodes{},
+		connect: func(ctx context.Context, endpoints []string) (talosClient, error) {
+			connected = append(connected, endpoints...)
+			return talostest.Connect(ctx, path)
+		},
+	}, &connected
+}
+
+func create() request {
+	return request{RequestType: "Create", ResourceProperties: properties{AutoScalingGroupNames: []string{"cp"}}}
+}
+
+func TestCreate(t *testing.T) {
+	tests := []struct {
+		name         string
+		bootstrapErr error
+	}{
+		{name: "bootstrap"},
+		{name: "already bootstrapped", bootstrapErr: status.Error(codes.AlreadyExists, "etcd data directory is not empty")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := &machineService{bootstrapErr: tt.bootstrapErr}
+			h, connected := newHandler(t, srv)
+
+			resp, err := h.handle(context.Background(), create())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if srv.bootstraps != 1 {
+				t.Errorf("Bootstrap called %d times, want 1", srv.bootstraps)
+			}
+			if resp.Data[bootstrapNodeKey] != "10.0.1.10" {
+				t.Errorf("Data = %v, want the oldest in-service node", resp.Data)
+			}
+			if len(*connected) != 1 || (*connected)[0] != "10.0.1.10" {
+				t.Errorf("connected to %v, want [10.0.1.10]", *connected)
+			}
+		})
+	}
+}
+
+func TestCreateBootstrapFails(t *testing.T) {
+	srv := &machineService{bootstrapErr: status.Error(codes.FailedPrecondition, "not a control plane node")}
+	h, _ := newHandler(t, srv)
+
+	if _, err := h.handle(context.Background(), create()); err == nil {
+		t.Fatal("expected the create to fail")
+	}
+	if srv.bootstraps != 1 {
+		t.Errorf("Bootstrap called %d times, want 1", srv.bootstraps)
+	}
+}
+
+func TestIsComplete(t *testing.T) {
+	tests := []struct {
+		name     string
+		state    string
+		healthy  bool
+		complete bool
+	}{
+		{name: "healthy", state: "Running", healthy: true, complete: true},
+		{name: "unhealthy", state: "Running"},
+		{name: "starting", state: "Preparing"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := &machineService{etcdState: tt.state, etcdHealthy: tt.healthy}
+			h, connected := newHandler(t, srv)
+
+			// The provider passes the Data of onEvent to every isComplete call
+			req := create()
+			req.PhysicalResourceID = "talos-bootstrap"
+			req.Data = map[string]string{bootstrapNodeKey: "10.0.3.10"}
+
+			resp, err := h.handle(context.Background(), req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if resp.IsComplete != tt.complete {
+				t.Errorf("IsComplete = %t, want %t", resp.IsComplete, tt.complete)
+			}
+			if resp.Data != nil {
+				t.Errorf("isComplete returned Data %v", resp.Data)
+			}
+			if srv.bootstraps != 0 {
+				t.Errorf("Bootstrap called %d times while polling", srv.bootstraps)
+			}
+			if len(*connected) != 1 || (*connected)[0] != "10.0.3.10" {
+				t.Errorf("connected to %v, want the node from Data", *connected)
+			}
+		})
+	}
+}
+
+func TestDelete(t *testing.T) {
+	srv := &machineService{}
+	h, connected := newHandler(t, srv)
+
+	resp, err := h.handle(context.Background(), request{RequestType: "Delete", PhysicalResourceID: "talos-bootstrap"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.IsComplete || len(*connected) != 0 {
+		t.Errorf("IsComplete = %t, connected to %v, want a no-op", resp.IsComplete, *connected)
+	}
+}
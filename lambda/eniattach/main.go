@@ -0,0 +1,157 @@
+// Command eniattach attaches a pre-created network interface to a control plane instance
+// when its autoscaling group launches it, so the node keeps the same private IP across replacements.
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+
+	"github.com/steveyackey/taloscdk/lambda/internal/lifecycle"
+)
+
+// availableTimeout bounds the wait for the interface to be released by a previous instance.
+// It has to leave room for the rest of the invocation within the function timeout (5 minutes).
+const availableTimeout = 4 * time.Minute
+
+// metadata is set as the lifecycle hook's NotificationMetadata by the construct
+type metadata struct {
+	NetworkInterfaceID string `json:"networkInterfaceId"`
+}
+
+// ec2Client is the subset of the EC2 API used by the handler. *ec2.Client satisfies it.
+type ec2Client interface {
+	ec2.DescribeNetworkInterfacesAPIClient
+	AttachNetworkInterface(ctx context.Context, params *ec2.AttachNetworkInterfaceInput, optFns ...func(*ec2.Options)) (*ec2.AttachNetworkInterfaceOutput, error)
+	ModifyNetworkInterfaceAttribute(ctx context.Context, params *ec2.ModifyNetworkInterfaceAttributeInput, optFns ...func(*ec2.Options)) (*ec2.ModifyNetworkInterfaceAttributeOutput, error)
+}
+
+type handler struct {
+	ec2         ec2Client
+	autoscaling lifecycle.Completer
+}
+
+func (h *handler) handle(ctx context.Context, event events.SNSEvent) error {
+	messages, err := lifecycle.Messages(event)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range messages {
+		if m.LifecycleTransition != lifecycle.Launching {
+			continue
+		}
+		if err := lifecycle.Complete(ctx, h.autoscaling, m, h.attach(ctx, m)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// attach waits for the interface to be released by any previous instance, then attaches it as eth1.
+// Redelivered notifications for an instance that already has the interface attached succeed.
+func (h *handler) attach(ctx context.Context, m lifecycle.Message) error {
+	var md metadata
+	if err := m.Metadata(&md); err != nil {
+		return fmt.Errorf("decoding hook metadata: %w", err)
+	}
+	if md.NetworkInterfaceID == "" {
+		return fmt.Errorf("hook %s has no networkInterfaceId metadata", m.LifecycleHookName)
+	}
+
+	attachment, err := h.attachment(ctx, md.NetworkInterfaceID)
+	if err != nil {
+		return err
+	}
+
+	if attachment == nil || aws.ToString(attachment.InstanceId) != m.EC2InstanceID {
+		waiter := ec2.NewNetworkInterfaceAvailableWaiter(h.ec2)
+		err = waiter.Wait(ctx, &ec2.DescribeNetworkInterfacesInput{
+			NetworkInterfaceIds: []string{md.NetworkInterfaceID},
+		}, availableTimeout)
+		if err != nil {
+			return fmt.Errorf("waiting for %s to become available: %w", md.NetworkInterfaceID, err)
+		}
+
+		_, err = h.ec2.AttachNetworkInterface(ctx, &ec2.AttachNetworkInterfaceInput{
+			InstanceId:         aws.String(m.EC2InstanceID),
+			NetworkInterfaceId: aws.String(md.NetworkInterfaceID),
+			DeviceIndex:        aws.Int32(1),
+		})
+		if err != nil {
+			return fmt.Errorf("attaching %s to %s: %w", md.NetworkInterfaceID, m.EC2InstanceID, err)
+		}
+
+		log.Printf("attached %s to %s", md.NetworkInterfaceID, m.EC2InstanceID)
+	} else {
+		log.Printf("%s is already attached to %s", md.NetworkInterfaceID, m.EC2InstanceID)
+	}
+
+	// Talos can't configure source based routing, so replies from the stable address leave through
+	// eth0, whose source/destination check would drop them. The check can only be set on the instance
+	// while it has a single interface.
+	primary, err := h.primaryInterface(ctx, m.EC2InstanceID)
+	if err != nil {
+		return err
+	}
+
+	_, err = h.ec2.ModifyNetworkInterfaceAttribute(ctx, &ec2.ModifyNetworkInterfaceAttributeInput{
+		NetworkInterfaceId: aws.String(primary),
+		SourceDestCheck:    &types.AttributeBooleanValue{Value: aws.Bool(false)},
+	})
+	if err != nil {
+		return fmt.Errorf("disabling the source/destination check of %s: %w", primary, err)
+	}
+
+	return nil
+}
+
+// primaryInterface returns the ID of the instance's eth0
+func (h *handler) primaryInterface(ctx context.Context, instanceID string) (string, error) {
+	out, err := h.ec2.DescribeNetworkInterfaces(ctx, &ec2.DescribeNetworkInterfacesInput{
+		Filters: []types.Filter{
+			{Name: aws.String("attachment.instance-id"), Values: []string{instanceID}},
+			{Name: aws.String("attachment.device-index"), Values: []string{"0"}},
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("describing the interfaces of %s: %w", instanceID, err)
+	}
+	if len(out.NetworkInterfaces) == 0 {
+		return "", fmt.Errorf("instance %s has no primary network interface", instanceID)
+	}
+	return aws.ToString(out.NetworkInterfaces[0].NetworkInterfaceId), nil
+}
+
+// attachment returns the current attachment of the interface, nil if it is detached
+func (h *handler) attachment(ctx context.Context, id string) (*types.NetworkInterfaceAttachment, error) {
+	out, err := h.ec2.DescribeNetworkInterfaces(ctx, &ec2.DescribeNetworkInterfacesInput{
+		NetworkInterfaceIds: []string{id},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("describing %s: %w", id, err)
+	}
+	if len(out.NetworkInterfaces) == 0 {
+		return nil, fmt.Errorf("network interface %s not found", id)
+	}
+	return out.NetworkInterfaces[0].Attachment, nil
+}
+
+func main() {
+	cfg, err := config.LoadDefaultConfig(context.Background())
+	if err != nil {
+		log.Fatalf("loading AWS config: %v", err)
+	}
+
+	h := &handler{ec2: ec2.NewFromConfig(cfg), autoscaling: autoscaling.NewFromConfig(cfg)}
+	lambda.Start(h.handle)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
+
+	"github.com/steveyackey/taloscdk/lambda/internal/lifecycle"
+)
+
+// fakeEC2 has the stable interface eni-stable and the primary interface eni-primary of the launched instance
+type fakeEC2 struct {
+	// attachedTo is the instance the stable interface is attached to, "" if it's available
+	attachedTo string
+
+	attached          []string
+	sourceDestChecked []string
+	instanceModified  int
+}
+
+func (f *fakeEC2) DescribeNetworkInterfaces(_ context.Context, params *ec2.DescribeNetworkInterfacesInput, _ ...func(*ec2.Options)) (*ec2.DescribeNetworkInterfacesOutput, error) {
+	if len(params.Filters) > 0 {
+		return &ec2.DescribeNetworkInterfacesOutput{NetworkInterfaces: []types.NetworkInterface{{NetworkInterfaceId: aws.String("eni-primary")}}}, nil
+	}
+
+	eni := types.NetworkInterface{NetworkInterfaceId: aws.String("eni-stable"), Status: types.NetworkInterfaceStatusAvailable}
+	if f.attachedTo != "" {
+		eni.Status = types.NetworkInterfaceStatusInUse
+		eni.Attachment = &types.NetworkInterfaceAttachment{InstanceId: aws.String(f.attachedTo)}
+	}
+	return &ec2.DescribeNetworkInterfacesOutput{NetworkInterfaces: []types.NetworkInterface{eni}}, nil
+}
+
+func (f *fakeEC2) AttachNetworkInterface(_ context.Context, params *ec2.AttachNetworkInterfaceInput, _ ...func(*ec2.Options)) (*ec2.AttachNetworkInterfaceOutput, error) {
+	if aws.ToInt32(params.DeviceIndex) != 1 {
+		return nil, errors.New("stable interface attached as eth0")
+	}
+	f.attached = append(f.attached, aws.ToString(params.InstanceId))
+	f.attachedTo = aws.ToString(params.InstanceId)
+	return &ec2.AttachNetworkInterfaceOutput{}, nil
+}
+
+func (f *fakeEC2) ModifyNetworkInterfaceAttribute(_ context.Context, params *ec2.ModifyNetworkInterfaceAttributeInput, _ ...func(*ec2.Options)) (*ec2.ModifyNetworkInterfaceAttributeOutput, error) {
+	if params.SourceDestCheck != nil && !aws.ToBool(params.SourceDestCheck.Value) {
+		f.sourceDestChecked = append(f.sourceDestChecked, aws.ToString(params.NetworkInterfaceId))
+	}
+	return &ec2.ModifyNetworkInterfaceAttributeOutput{}, nil
+}
+
+// ModifyInstanceAttribute fails like EC2 does for instances with more than one interface
+func (f *fakeEC2) ModifyInstanceAttribute(context.Context, *ec2.ModifyInstanceAttributeInput, ...func(*ec2.Options)) (*ec2.ModifyInstanceAttributeOutput, error) {
+	f.instanceModified++
+	return nil, &smithy.GenericAPIError{
+		Code:    "InvalidInstanceID",
+		Message: "There are multiple interfaces attached to instance 'i-new'. Please specify an interface ID for the operation instead.",
+	}
+}
+
+type fakeAutoScaling struct {
+	results []string
+}
+
+func (a *fakeAutoScaling) CompleteLifecycleAction(_ context.Context, params *autoscaling.CompleteLifecycleActionInput, _ ...func(*autoscaling.Options)) (*autoscaling.CompleteLifecycleActionOutput, error) {
+	a.results = append(a.results, aws.ToString(params.LifecycleActionResult))
+	return &autoscaling.CompleteLifecycleActionOutput{}, nil
+}
+
+func launching(t *testing.T) events.SNSEvent {
+	msg, err := json.Marshal(lifecycle.Message{
+		AutoScalingGroupName: "cp",
+		LifecycleHookName:    "AttachENI",
+		EC2InstanceID:        "i-new",
+		LifecycleTransition:  lifecycle.Launching,
+		NotificationMetadata: `{"networkInterfaceId":"eni-stable"}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return events.SNSEvent{Records: []events.SNSEventRecord{{SNS: events.SNSEntity{Message: string(msg)}}}}
+}
+
+func TestAttach(t *testing.T) {
+	tests := []struct {
+		name       string
+		attachedTo string
+		attached   []string
+	}{
+		{name: "available", attached: []string{"i-new"}},
+		{name: "redelivered", attachedTo: "i-new"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ec2Client := &fakeEC2{attachedTo: tt.attachedTo}
+			asg := &fakeAutoScaling{}
+			h := &handler{ec2: ec2Client, autoscaling: asg}
+
+			if err := h.handle(context.Background(), launching(t)); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(ec2Client.attached) != len(tt.attached) {
+				t.Errorf("attached to %v, want %v", ec2Client.attached, tt.attached)
+			}
+			if len(ec2Client.sourceDestChecked) != 1 || ec2Client.sourceDestChecked[0] != "eni-primary" {
+				t.Errorf("disabled the source/destination check of %v, want [eni-primary]", ec2Client.sourceDestChecked)
+			}
+			if ec2Client.instanceModified != 0 {
+				t.Errorf("modified the instance attribute %d times, which fails with two interfaces", ec2Client.instanceModified)
+			}
+			if len(asg.results) != 1 || asg.results[0] != "CONTINUE" {
+				t.Errorf("lifecycle results = %v, want [CONTINUE]", asg.results)
+			}
+		})
+	}
+}
+
+func TestAttachWithoutMetadata(t *testing.T) {
+	asg := &fakeAutoScaling{}
+	h := &handler{ec2: &fakeEC2{}, autoscaling: asg}
+
+	event := launching(t)
+	var m lifecycle.Message
+	if err := json.Unmarshal([]byte(event.Records[0].SNS.Message), &m); err != nil {
+		t.Fatal(err)
+	}
+	m.NotificationMetadata = ""
+	msg, _ := json.Marshal(m)
+	event.Records[0].SNS.Message = string(msg)
+
+	if err := h.handle(context.Background(), event); err == nil {
+		t.Fatal("expected an error without networkInterfaceId metadata")
+	}
+	if len(asg.results) != 1 || asg.results[0] != "ABANDON" {
+		t.Errorf("lifecycle results = %v, want [ABANDON]", asg.results)
+	}
+}
@@ -0,0 +1,203 @@
+// Command etcdcleanup removes a control plane node from etcd when its autoscaling group terminates it,
+// so stale members never accumulate and break quorum.
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	machineapi "github.com/siderolabs/talos/pkg/machinery/api/machine"
+	"google.golang.org/grpc"
+
+	"github.com/steveyackey/taloscdk/lambda/internal/lifecycle"
+	"github.com/steveyackey/taloscdk/lambda/internal/nodes"
+	"github.com/steveyackey/taloscdk/lambda/internal/talosapi"
+)
+
+// asgNamesEnv lists the control plane autoscaling groups, comma separated
+const asgNamesEnv = "CONTROL_PLANE_ASGS"
+
+// etcdClient is the subset of the Talos API used by the handler. *client.Client satisfies it.
+type etcdClient interface {
+	EtcdLeaveCluster(ctx context.Context, req *machineapi.EtcdLeaveClusterRequest, callOptions ...grpc.CallOption) error
+	EtcdMemberList(ctx context.Context, req *machineapi.EtcdMemberListRequest, callOptions ...grpc.CallOption) (*machineapi.EtcdMemberListResponse, error)
+	EtcdRemoveMemberByID(ctx context.Context, req *machineapi.EtcdRemoveMemberByIDRequest, callOptions ...grpc.CallOption) error
+	Close() error
+}
+
+type autoscalingClient interface {
+	lifecycle.Completer
+	nodes.AutoScaling
+}
+
+type handler struct {
+	ec2         nodes.EC2
+	autoscaling autoscalingClient
+	asgNames    []string
+
+	// connect opens a Talos API client for the given endpoints
+	connect func(ctx context.Context, endpoints []string) (etcdClient, error)
+}
+
+func (h *handler) handle(ctx context.Context, event events.SNSEvent) error {
+	messages, err := lifecycle.Messages(event)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range messages {
+		if m.LifecycleTransition != lifecycle.Terminating {
+			continue
+		}
+		if err := lifecycle.Complete(ctx, h.autoscaling, m, h.removeMember(ctx, m.EC2InstanceID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeMember asks the terminating node to leave etcd. If the node can't do that itself
+// (e.g. it is unhealthy), the member is removed through one of the remaining control plane nodes.
+func (h *handler) removeMember(ctx context.Context, instanceID string) error {
+	instances, err := nodes.Describe(ctx, h.ec2, []string{instanceID})
+	if err != nil {
+		return err
+	}
+	if len(instances) == 0 || instances[0].PrivateIP == "" {
+		return fmt.Errorf("instance %s has no private IP", instanceID)
+	}
+	ip := instances[0].PrivateIP
+
+	leaveErr := h.leave(ctx, ip)
+	if leaveErr == nil {
+		log.Printf("%s (%s) left etcd", instanceID, ip)
+		return nil
+	}
+	log.Printf("%s (%s) could not leave etcd, removing it from a peer: %v", instanceID, ip, leaveErr)
+
+	peers, err := h.peerIPs(ctx, instanceID)
+	if err != nil {
+		return err
+	}
+	if len(peers) == 0 {
+		return fmt.Errorf("no remaining control plane nodes to remove %s from etcd: %w", ip, leaveErr)
+	}
+
+	return h.removeFromPeers(ctx, instances[0], peers)
+}
+
+func (h *handler) leave(ctx context.Context, ip string) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	c, err := h.connect(ctx, []string{ip})
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	return c.EtcdLeaveCluster(ctx, &machineapi.EtcdLeaveClusterRequest{})
+}
+
+// removeFromPeers removes the member advertising any address of instance, which is the stable ENI
+// address rather than the primary IP when the control plane uses StablePrivateIPs
+func (h *handler) removeFromPeers(ctx context.Context, instance nodes.Instance, peers []string) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	c, err := h.connect(ctx, peers)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	resp, err := c.EtcdMemberList(ctx, &machineapi.EtcdMemberListRequest{})
+	if err != nil {
+		return fmt.Errorf("listing etcd members: %w", err)
+	}
+
+	for _, msg := range resp.GetMessages() {
+		for _, member := range msg.GetMembers() {
+			if !hasPeerIP(member.GetPeerUrls(), instance.Addresses) {
+				continue
+			}
+
+			if err := c.EtcdRemoveMemberByID(ctx, &machineapi.EtcdRemoveMemberByIDRequest{MemberId: member.GetId()}); err != nil {
+				return fmt.Errorf("removing etcd member %x (%s): %w", member.GetId(), instance.ID, err)
+			}
+
+			log.Printf("removed etcd member %x (%s)", member.GetId(), instance.ID)
+			return nil
+		}
+	}
+
+	log.Printf("%s (%v) is not an etcd member, nothing to remove", instance.ID, instance.Addresses)
+	return nil
+}
+
+// peerIPs returns the private IPs of in-service control plane instances, excluding instanceID
+func (h *handler) peerIPs(ctx context.Context, instanceID string) ([]string, error) {
+	instances, err := nodes.InService(ctx, h.autoscaling, h.ec2, h.asgNames)
+	if err != nil {
+		return nil, err
+	}
+
+	var peers []nodes.Instance
+	for _, instance := range instances {
+		if instance.ID != instanceID {
+			peers = append(peers, instance)
+		}
+	}
+	return nodes.PrivateIPs(peers), nil
+}
+
+// hasPeerIP reports whether any of the etcd peer URLs points at one of ips
+func hasPeerIP(peerURLs []string, ips []string) bool {
+	for _, peerURL := range peerURLs {
+		u, err := url.Parse(peerURL)
+		if err != nil {
+			continue
+		}
+		for _, ip := range ips {
+			if u.Hostname() == ip {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func main() {
+	ctx := context.Background()
+
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		log.Fatalf("loading AWS config: %v", err)
+	}
+
+	talosconfig, err := talosapi.LoadTalosconfig(ctx, secretsmanager.NewFromConfig(cfg))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	h := &handler{
+		ec2:         ec2.NewFromConfig(cfg),
+		autoscaling: autoscaling.NewFromConfig(cfg),
+		asgNames:    strings.Split(os.Getenv(asgNamesEnv), ","),
+		connect: func(ctx context.Context, endpoints []string) (etcdClient, error) {
+			return talosapi.Connect(ctx, talosconfig, endpoints)
+		},
+	}
+	lambda.Start(h.handle)
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	astypes "github.com/aws/aws-sdk-go-v2/service/autoscaling/types"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	machineapi "github.com/siderolabs/talos/pkg/machinery/api/machine"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/steveyackey/taloscdk/lambda/internal/lifecycle"
+	"github.com/steveyackey/taloscdk/lambda/internal/talostest"
+)
+
+// machineService is a Talos API stand-in with a fixed etcd membership
+type machineService struct {
+	machineapi.UnimplementedMachineServiceServer
+
+	leaveErr error
+	members  []*machineapi.EtcdMember
+	removed  []uint64
+}
+
+func (s *machineService) EtcdLeaveCluster(context.Context, *machineapi.EtcdLeaveClusterRequest) (*machineapi.EtcdLeaveClusterResponse, error) {
+	if s.leaveErr != nil {
+		return nil, s.leaveErr
+	}
+	return &machineapi.EtcdLeaveClusterResponse{Messages: []*machineapi.EtcdLeaveCluster{{}}}, nil
+}
+
+func (s *machineService) EtcdMemberList(context.Context, *machineapi.EtcdMemberListRequest) (*machineapi.EtcdMemberListResponse, error) {
+	return &machineapi.EtcdMemberListResponse{Messages: []*machineapi.EtcdMembers{{Members: s.members}}}, nil
+}
+
+func (s *machineService) EtcdRemoveMemberByID(_ context.Context, req *machineapi.EtcdRemoveMemberByIDRequest) (*machineapi.EtcdRemoveMemberByIDResponse, error) {
+	s.removed = append(s.removed, req.GetMemberId())
+	return &machineapi.EtcdRemoveMemberByIDResponse{Messages: []*machineapi.EtcdRemoveMemberByID{{}}}, nil
+}
+
+// fakeEC2 describes the terminating instance, which has a stable ENI as its second interface
+type fakeEC2 struct{}
+
+func (fakeEC2) DescribeInstances(_ context.Context, params *ec2.DescribeInstancesInput, _ ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
+	var instances []ec2types.Instance
+	for _, id := range params.InstanceIds {
+		ip := map[string]string{"i-old": "10.0.1.10", "i-peer": "10.0.2.10"}[id]
+		instances = append(instances, ec2types.Instance{
+			InstanceId:       aws.String(id),
+			PrivateIpAddress: aws.String(ip),
+			NetworkInterfaces: []ec2types.InstanceNetworkInterface{
+				{PrivateIpAddresses: []ec2types.InstancePrivateIpAddress{{PrivateIpAddress: aws.String(ip)}}},
+				{PrivateIpAddresses: []ec2types.InstancePrivateIpAddress{{PrivateIpAddress: aws.String(ip[:len(ip)-2] + "99")}}},
+			},
+		})
+	}
+	return &ec2.DescribeInstancesOutput{Reservations: []ec2types.Reservation{{Instances: instances}}}, nil
+}
+
+type fakeAutoScaling struct {
+	results []string
+}
+
+func (*fakeAutoScaling) DescribeAutoScalingGroups(context.Context, *autoscaling.DescribeAutoScalingGroupsInput, ...func(*autoscaling.Options)) (*autoscaling.DescribeAutoScalingGroupsOutput, error) {
+	return &autoscaling.DescribeAutoScalingGroupsOutput{AutoScalingGroups: []astypes.AutoScalingGroup{{
+		Instances: []astypes.Instance{
+			{InstanceId: aws.String("i-old"), LifecycleState: astypes.LifecycleStateTerminatingWait},
+			{InstanceId: aws.String("i-peer"), LifecycleState: astypes.LifecycleStateInService},
+		},
+	}}}, nil
+}
+
+func (a *fakeAutoScaling) CompleteLifecycleAction(_ context.Context, params *autoscaling.CompleteLifecycleActionInput, _ ...func(*autoscaling.Options)) (*autoscaling.CompleteLifecycleActionOutput, error) {
+	a.results = append(a.results, aws.ToString(params.LifecycleActionResult))
+	return &autoscaling.CompleteLifecycleActionOutput{}, nil
+}
+
+func terminating(t *testing.T, instanceID string) events.SNSEvent {
+	msg, err := json.Marshal(lifecycle.Message{
+		AutoScalingGroupName: "cp",
+		EC2InstanceID:        instanceID,
+		LifecycleTransition:  lifecycle.Terminating,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return events.SNSEvent{Records: []events.SNSEventRecord{{SNS: events.SNSEntity{Message: string(msg)}}}}
+}
+
+// newHandler routes connections to the terminating node's address to old and all others to peer
+func newHandler(t *testing.T, old, peer *machineService) (*handler, *fakeAutoScaling) {
+	oldPath, peerPath := talostest.Serve(t, old), talostest.Serve(t, peer)
+	asg := &fakeAutoScaling{}
+
+	return &handler{
+		ec2:         fakeEC2{},
+		autoscaling: asg,
+		asgNames:    []string{"cp"},
+		connect: func(ctx context.Context, endpoints []string) (etcdClient, error) {
+			if endpoints[0] == "10.0.1.10" {
+				return talostest.Connect(ctx, oldPath)
+			}
+			return talostest.Connect(ctx, peerPath)
+		},
+	}, asg
+}
+
+func TestLeave(t *testing.T) {
+	old, peer := &machineService{}, &machineService{}
+	h, asg := newHandler(t, old, peer)
+
+	if err := h.handle(context.Background(), terminating(t, "i-old")); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(peer.removed) != 0 {
+		t.Errorf("removed members %v through a peer after the node left itself", peer.removed)
+	}
+	if len(asg.results) != 1 || asg.results[0] != "CONTINUE" {
+		t.Errorf("lifecycle results = %v, want [CONTINUE]", asg.results)
+	}
+}
+
+func TestRemoveMemberFromPeer(t *testing.T) {
+	tests := []struct {
+		name    string
+		peerURL string
+		removed []uint64
+	}{
+		{name: "primary IP", peerURL: "https://10.0.1.10:2380", removed: []uint64{0xa}},
+		{name: "stable ENI IP", peerURL: "https://10.0.1.99:2380", removed: []uint64{0xa}},
+		{name: "not a member", peerURL: "https://10.0.3.10:2380"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old := &machineService{leaveErr: status.Error(codes.Unavailable, "etcd is down")}
+			peer := &machineService{members: []*machineapi.EtcdMember{
+				{Id: 0xa, PeerUrls: []string{tt.peerURL}},
+				{Id: 0xb, PeerUrls: []string{"https://10.0.2.99:2380"}},
+			}}
+			h, asg := newHandler(t, old, peer)
+
+			if err := h.handle(context.Background(), terminating(t, "i-old")); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(peer.removed) != len(tt.removed) || (len(tt.removed) > 0 && peer.removed[0] != tt.removed[0]) {
+				t.Errorf("removed members %v, want %v", peer.removed, tt.removed)
+			}
+			if len(asg.results) != 1 || asg.results[0] != "CONTINUE" {
+				t.Errorf("lifecycle results = %v, want [CONTINUE]", asg.results)
+			}
+		})
+	}
+}
+
+func TestRemoveMemberWithoutPeers(t *testing.T) {
+	old := &machineService{leaveErr: errors.New("unreachable")}
+	h, asg := newHandler(t, old, &machineService{})
+	h.autoscaling = &noPeers{asg}
+
+	if err := h.handle(context.Background(), terminating(t, "i-old")); err == nil {
+		t.Fatal("expected an error without remaining control plane nodes")
+	}
+	if len(asg.results) != 1 || asg.results[0] != "ABANDON" {
+		t.Errorf("lifecycle results = %v, want [ABANDON]", asg.results)
+	}
+}
+
+// noPeers reports the terminating instance as the only control plane node
+type noPeers struct {
+	*fakeAutoScaling
+}
+
+func (*noPeers) DescribeAutoScalingGroups(context.Context, *autoscaling.DescribeAutoScalingGroupsInput, ...func(*autoscaling.Options)) (*autoscaling.DescribeAutoScalingGroupsOutput, error) {
+	return &autoscaling.DescribeAutoScalingGroupsOutput{}, nil
+}
@@ -0,0 +1,87 @@
+// Package lifecycle handles EC2 Auto Scaling lifecycle hook notifications delivered through SNS.
+package lifecycle
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+)
+
+const (
+	// Launching is the transition sent for EC2_INSTANCE_LAUNCHING hooks
+	Launching = "autoscaling:EC2_INSTANCE_LAUNCHING"
+
+	// Terminating is the transition sent for EC2_INSTANCE_TERMINATING hooks
+	Terminating = "autoscaling:EC2_INSTANCE_TERMINATING"
+
+	testNotification = "autoscaling:TEST_NOTIFICATION"
+)
+
+// Message is the lifecycle hook notification published by EC2 Auto Scaling
+type Message struct {
+	Event                string `json:"Event"`
+	LifecycleHookName    string `json:"LifecycleHookName"`
+	AutoScalingGroupName string `json:"AutoScalingGroupName"`
+	EC2InstanceID        string `json:"EC2InstanceId"`
+	LifecycleActionToken string `json:"LifecycleActionToken"`
+	LifecycleTransition  string `json:"LifecycleTransition"`
+	NotificationMetadata string `json:"NotificationMetadata"`
+}
+
+// Metadata unmarshals the hook's NotificationMetadata into v
+func (m Message) Metadata(v interface{}) error {
+	if m.NotificationMetadata == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(m.NotificationMetadata), v)
+}
+
+// Completer completes lifecycle actions. *autoscaling.Client satisfies it.
+type Completer interface {
+	CompleteLifecycleAction(ctx context.Context, params *autoscaling.CompleteLifecycleActionInput, optFns ...func(*autoscaling.Options)) (*autoscaling.CompleteLifecycleActionOutput, error)
+}
+
+// Messages returns the lifecycle messages in an SNS event, skipping test notifications
+func Messages(event events.SNSEvent) ([]Message, error) {
+	var messages []Message
+	for _, record := range event.Records {
+		var m Message
+		if err := json.Unmarshal([]byte(record.SNS.Message), &m); err != nil {
+			return nil, fmt.Errorf("decoding lifecycle message: %w", err)
+		}
+		if m.Event == testNotification {
+			continue
+		}
+		messages = append(messages, m)
+	}
+	return messages, nil
+}
+
+// Complete finishes the lifecycle action, continuing when err is nil and abandoning otherwise.
+// The original error is returned so the invocation is reported as failed.
+func Complete(ctx context.Context, client Completer, m Message, err error) error {
+	result := "CONTINUE"
+	if err != nil {
+		result = "ABANDON"
+	}
+
+	_, completeErr := client.CompleteLifecycleAction(ctx, &autoscaling.CompleteLifecycleActionInput{
+		AutoScalingGroupName:  aws.String(m.AutoScalingGroupName),
+		LifecycleHookName:     aws.String(m.LifecycleHookName),
+		LifecycleActionToken:  aws.String(m.LifecycleActionToken),
+		InstanceId:            aws.String(m.EC2InstanceID),
+		LifecycleActionResult: aws.String(result),
+	})
+
+	if err != nil {
+		return err
+	}
+	if completeErr != nil {
+		return fmt.Errorf("completing lifecycle action for %s: %w", m.EC2InstanceID, completeErr)
+	}
+	return nil
+}
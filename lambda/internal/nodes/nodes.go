@@ -0,0 +1,127 @@
+// Package nodes finds the EC2 instances backing cluster autoscaling groups.
+package nodes
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling/types"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// AutoScaling describes autoscaling groups. *autoscaling.Client satisfies it.
+type AutoScaling interface {
+	DescribeAutoScalingGroups(ctx context.Context, params *autoscaling.DescribeAutoScalingGroupsInput, optFns ...func(*autoscaling.Options)) (*autoscaling.DescribeAutoScalingGroupsOutput, error)
+}
+
+// EC2 describes instances. *ec2.Client satisfies it.
+type EC2 interface {
+	DescribeInstances(ctx context.Context, params *ec2.DescribeInstancesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error)
+}
+
+// Instance is a running cluster node
+type Instance struct {
+	ID         string
+	PrivateIP  string
+	LaunchTime time.Time
+
+	// Addresses are the private IPs of all network interfaces, e.g. including a stable secondary ENI
+	Addresses []string
+}
+
+// InService returns the in-service instances of the named autoscaling groups, oldest first
+func InService(ctx context.Context, asg AutoScaling, ec2Client EC2, groupNames []string) ([]Instance, error) {
+	out, err := asg.DescribeAutoScalingGroups(ctx, &autoscaling.DescribeAutoScalingGroupsInput{
+		AutoScalingGroupNames: groupNames,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("describing autoscaling groups %v: %w", groupNames, err)
+	}
+
+	var ids []string
+	for _, group := range out.AutoScalingGroups {
+		for _, instance := range group.Instances {
+			if instance.LifecycleState == types.LifecycleStateInService {
+				ids = append(ids, aws.ToString(instance.InstanceId))
+			}
+		}
+	}
+
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	return Describe(ctx, ec2Client, ids)
+}
+
+// Describe returns the given instances, oldest first
+func Describe(ctx context.Context, ec2Client EC2, instanceIDs []string) ([]Instance, error) {
+	out, err := ec2Client.DescribeInstances(ctx, &ec2.DescribeInstancesInput{InstanceIds: instanceIDs})
+	if err != nil {
+		return nil, fmt.Errorf("describing instances %v: %w", instanceIDs, err)
+	}
+
+	return sortedInstances(out), nil
+}
+
+// Tagged returns the running instances carrying tagKey (with any value), oldest first
+func Tagged(ctx context.Context, ec2Client EC2, tagKey string) ([]Instance, error) {
+	out, err := ec2Client.DescribeInstances(ctx, &ec2.DescribeInstancesInput{
+		Filters: []ec2types.Filter{
+			{Name: aws.String("tag-key"), Values: []string{tagKey}},
+			{Name: aws.String("instance-state-name"), Values: []string{"running"}},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("describing instances tagged %s: %w", tagKey, err)
+	}
+
+	return sortedInstances(out), nil
+}
+
+// sortedInstances returns the instances of out, oldest first
+func sortedInstances(out *ec2.DescribeInstancesOutput) []Instance {
+	var instances []Instance
+	for _, reservation := range out.Reservations {
+		for _, instance := range reservation.Instances {
+			var addresses []string
+			for _, eni := range instance.NetworkInterfaces {
+				for _, address := range eni.PrivateIpAddresses {
+					addresses = append(addresses, aws.ToString(address.PrivateIpAddress))
+				}
+			}
+
+			instances = append(instances, Instance{
+				ID:         aws.ToString(instance.InstanceId),
+				PrivateIP:  aws.ToString(instance.PrivateIpAddress),
+				LaunchTime: aws.ToTime(instance.LaunchTime),
+				Addresses:  addresses,
+			})
+		}
+	}
+
+	sort.SliceStable(instances, func(i, j int) bool {
+		if instances[i].LaunchTime.Equal(instances[j].LaunchTime) {
+			return instances[i].ID < instances[j].ID
+		}
+		return instances[i].LaunchTime.Before(instances[j].LaunchTime)
+	})
+
+	return instances
+}
+
+// PrivateIPs returns the private IPs of instances, skipping instances without one
+func PrivateIPs(instances []Instance) []string {
+	var ips []string
+	for _, instance := range instances {
+		if instance.PrivateIP != "" {
+			ips = append(ips, instance.PrivateIP)
+		}
+	}
+	return ips
+}
@@ -0,0 +1,75 @@
+// Package talosapi connects Lambda handlers to the Talos API (apid) of cluster nodes.
+package talosapi
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/siderolabs/talos/pkg/machinery/client"
+	clientconfig "github.com/siderolabs/talos/pkg/machinery/client/config"
+)
+
+// TalosconfigSecretEnv is the environment variable holding the ARN of the talosconfig secret
+const TalosconfigSecretEnv = "TALOSCONFIG_SECRET_ARN"
+
+// SecretGetter reads secrets. *secretsmanager.Client satisfies it.
+type SecretGetter interface {
+	GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error)
+}
+
+// LoadTalosconfig returns the talosconfig stored in the secret named by TALOSCONFIG_SECRET_ARN
+func LoadTalosconfig(ctx context.Context, sm SecretGetter) (string, error) {
+	arn := os.Getenv(TalosconfigSecretEnv)
+	if arn == "" {
+		return "", fmt.Errorf("%s is not set", TalosconfigSecretEnv)
+	}
+
+	out, err := sm.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{SecretId: aws.String(arn)})
+	if err != nil {
+		return "", fmt.Errorf("reading talosconfig secret: %w", err)
+	}
+
+	return aws.ToString(out.SecretString), nil
+}
+
+// Connect returns a client for the Talos API on endpoints, authenticated with the current context
+// of talosconfig. opts are applied last, so they can override the TLS or gRPC dial options,
+// e.g. to reach a local stand-in server.
+func Connect(ctx context.Context, talosconfig string, endpoints []string, opts ...client.OptionFunc) (*client.Client, error) {
+	cfg, err := clientconfig.FromString(talosconfig)
+	if err != nil {
+		return nil, fmt.Errorf("parsing talosconfig: %w", err)
+	}
+
+	options := append([]client.OptionFunc{
+		client.WithConfig(cfg),
+		client.WithEndpoints(endpoints...),
+	}, opts...)
+
+	c, err := client.New(ctx, options...)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to Talos API on %v: %w", endpoints, err)
+	}
+
+	return c, nil
+}
+
+// ConnectMaintenance returns a client for the maintenance API of nodes booted without a config.
+// The maintenance API has no client authentication and serves a self-signed certificate.
+func ConnectMaintenance(ctx context.Context, endpoints []string, opts ...client.OptionFunc) (*client.Client, error) {
+	options := append([]client.OptionFunc{
+		client.WithTLSConfig(&tls.Config{InsecureSkipVerify: true}),
+		client.WithEndpoints(endpoints...),
+	}, opts...)
+
+	c, err := client.New(ctx, options...)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to maintenance API on %v: %w", endpoints, err)
+	}
+
+	return c, nil
+}
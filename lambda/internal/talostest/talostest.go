@@ -0,0 +1,44 @@
+// Package talostest runs an in-process stand-in for the Talos API, so handlers can be tested
+// through their injected connect functions with a real Talos client.
+package talostest
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+
+	machineapi "github.com/siderolabs/talos/pkg/machinery/api/machine"
+	"github.com/siderolabs/talos/pkg/machinery/client"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Serve starts srv on a unix socket until the test ends and returns the socket path.
+// Embed machineapi.UnimplementedMachineServiceServer in srv and override the calls under test.
+func Serve(t *testing.T, srv machineapi.MachineServiceServer) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "apid.sock")
+
+	lis, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("listening on %s: %v", path, err)
+	}
+
+	s := grpc.NewServer()
+	machineapi.RegisterMachineServiceServer(s, srv)
+
+	go func() { _ = s.Serve(lis) }()
+	t.Cleanup(s.Stop)
+
+	return path
+}
+
+// Connect returns a Talos client for the server listening on path
+func Connect(ctx context.Context, path string) (*client.Client, error) {
+	return client.New(ctx,
+		client.WithUnixSocket(path),
+		client.WithGRPCDialOptions(grpc.WithTransportCredentials(insecure.NewCredentials())),
+	)
+}
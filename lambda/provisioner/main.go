@@ -0,0 +1,163 @@
+// Command provisioner delivers machine configs to nodes booted into Talos maintenance mode.
+// When an autoscaling group launches an instance, the config is read from Secrets Manager and
+// applied through the maintenance API, so it never appears in EC2 user data.
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	machineapi "github.com/siderolabs/talos/pkg/machinery/api/machine"
+	"google.golang.org/grpc"
+
+	"github.com/steveyackey/taloscdk/lambda/internal/lifecycle"
+	"github.com/steveyackey/taloscdk/lambda/internal/nodes"
+	"github.com/steveyackey/taloscdk/lambda/internal/talosapi"
+)
+
+const (
+	// retryMargin is left of the invocation after retrying, to abandon the lifecycle action in time
+	retryMargin = time.Minute
+
+	// completeTimeout bounds completing the lifecycle action, which happens after ctx may have expired
+	completeTimeout = 30 * time.Second
+)
+
+// metadata is set as the lifecycle hook's NotificationMetadata by the construct
+type metadata struct {
+	ConfigSecretARN string `json:"configSecretArn"`
+}
+
+// maintenanceClient is the subset of the maintenance API used by the handler. *client.Client satisfies it.
+type maintenanceClient interface {
+	ApplyConfiguration(ctx context.Context, req *machineapi.ApplyConfigurationRequest, callOptions ...grpc.CallOption) (*machineapi.ApplyConfigurationResponse, error)
+	Close() error
+}
+
+type handler struct {
+	ec2         nodes.EC2
+	autoscaling lifecycle.Completer
+	secrets     talosapi.SecretGetter
+
+	// connect opens a maintenance API client for the given endpoints
+	connect func(ctx context.Context, endpoints []string) (maintenanceClient, error)
+
+	// retryInterval between attempts to reach a booting node
+	retryInterval time.Duration
+}
+
+func (h *handler) handle(ctx context.Context, event events.SNSEvent) error {
+	messages, err := lifecycle.Messages(event)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range messages {
+		if m.LifecycleTransition != lifecycle.Launching {
+			continue
+		}
+		if err := h.complete(m, h.provision(ctx, m)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// complete finishes the lifecycle action with a fresh context, so an instance that couldn't be
+// provisioned is abandoned right away instead of waiting for the hook heartbeat to run out
+func (h *handler) complete(m lifecycle.Message, err error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), completeTimeout)
+	defer cancel()
+
+	return lifecycle.Complete(ctx, h.autoscaling, m, err)
+}
+
+func (h *handler) provision(ctx context.Context, m lifecycle.Message) error {
+	var md metadata
+	if err := m.Metadata(&md); err != nil {
+		return fmt.Errorf("decoding hook metadata: %w", err)
+	}
+	if md.ConfigSecretARN == "" {
+		return fmt.Errorf("hook %s has no configSecretArn metadata", m.LifecycleHookName)
+	}
+
+	secret, err := h.secrets.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{SecretId: aws.String(md.ConfigSecretARN)})
+	if err != nil {
+		return fmt.Errorf("reading machine config secret: %w", err)
+	}
+
+	instances, err := nodes.Describe(ctx, h.ec2, []string{m.EC2InstanceID})
+	if err != nil {
+		return err
+	}
+	ips := nodes.PrivateIPs(instances)
+	if len(ips) == 0 {
+		return fmt.Errorf("instance %s has no private IP", m.EC2InstanceID)
+	}
+
+	// The maintenance API comes up shortly after boot, retry until shortly before the invocation times out
+	if deadline, ok := ctx.Deadline(); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline.Add(-retryMargin))
+		defer cancel()
+	}
+
+	for {
+		err = h.apply(ctx, ips[0], []byte(aws.ToString(secret.SecretString)))
+		if err == nil {
+			log.Printf("applied machine config to %s (%s)", m.EC2InstanceID, ips[0])
+			return nil
+		}
+		log.Printf("%s: %v", ips[0], err)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("applying machine config to %s: %w", m.EC2InstanceID, err)
+		case <-time.After(h.retryInterval):
+		}
+	}
+}
+
+func (h *handler) apply(ctx context.Context, ip string, config []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	c, err := h.connect(ctx, []string{ip})
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	_, err = c.ApplyConfiguration(ctx, &machineapi.ApplyConfigurationRequest{
+		Data: config,
+		Mode: machineapi.ApplyConfigurationRequest_AUTO,
+	})
+	return err
+}
+
+func main() {
+	cfg, err := config.LoadDefaultConfig(context.Background())
+	if err != nil {
+		log.Fatalf("loading AWS config: %v", err)
+	}
+
+	h := &handler{
+		ec2:         ec2.NewFromConfig(cfg),
+		autoscaling: autoscaling.NewFromConfig(cfg),
+		secrets:     secretsmanager.NewFromConfig(cfg),
+		connect: func(ctx context.Context, endpoints []string) (maintenanceClient, error) {
+			return talosapi.ConnectMaintenance(ctx, endpoints)
+		},
+		retryInterval: 10 * time.Second,
+	}
+	lambda.Start(h.handle)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	machineapi "github.com/siderolabs/talos/pkg/machinery/api/machine"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/steveyackey/taloscdk/lambda/internal/lifecycle"
+	"github.com/steveyackey/taloscdk/lambda/internal/talostest"
+)
+
+const machineConfig = "version: v1alpha1\nmachine:\n  type: worker\n"
+
+// machineService is a maintenance API stand-in that only comes up after failures attempts, never if negative
+type machineService struct {
+	machineapi.UnimplementedMachineServiceServer
+
+	failures int
+	applied  []*machineapi.ApplyConfigurationRequest
+}
+
+func (s *machineService) ApplyConfiguration(_ context.Context, req *machineapi.ApplyConfigurationRequest) (*machineapi.ApplyConfigurationResponse, error) {
+	if s.failures != 0 {
+		s.failures--
+		return nil, status.Error(codes.Unavailable, "maintenance API is not up yet")
+	}
+	s.applied = append(s.applied, req)
+	return &machineapi.ApplyConfigurationResponse{Messages: []*machineapi.ApplyConfiguration{{}}}, nil
+}
+
+// fakeEC2 describes the launched instance
+type fakeEC2 struct{}
+
+func (fakeEC2) DescribeInstances(_ context.Context, params *ec2.DescribeInstancesInput, _ ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
+	return &ec2.DescribeInstancesOutput{Reservations: []ec2types.Reservation{{Instances: []ec2types.Instance{{
+		InstanceId:       aws.String(params.InstanceIds[0]),
+		PrivateIpAddress: aws.String("10.0.1.10"),
+	}}}}}, nil
+}
+
+// fakeSecrets holds the machine config secret
+type fakeSecrets struct{}
+
+func (fakeSecrets) GetSecretValue(_ context.Context, params *secretsmanager.GetSecretValueInput, _ ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
+	return &secretsmanager.GetSecretValueOutput{ARN: params.SecretId, SecretString: aws.String(machineConfig)}, nil
+}
+
+type fakeAutoScaling struct {
+	results []string
+}
+
+func (a *fakeAutoScaling) CompleteLifecycleAction(_ context.Context, params *autoscaling.CompleteLifecycleActionInput, _ ...func(*autoscaling.Options)) (*autoscaling.CompleteLifecycleActionOutput, error) {
+	a.results = append(a.results, aws.ToString(params.LifecycleActionResult))
+	return &autoscaling.CompleteLifecycleActionOutput{}, nil
+}
+
+func launching(t *testing.T) events.SNSEvent {
+	msg, err := json.Marshal(lifecycle.Message{
+		AutoScalingGroupName: "workers",
+		LifecycleHookName:    "ApplyConfig",
+		EC2InstanceID:        "i-new",
+		LifecycleTransition:  lifecycle.Launching,
+		NotificationMetadata: `{"configSecretArn":"arn:aws:secretsmanager:us-east-1:123456789012:secret:config"}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return events.SNSEvent{Records: []events.SNSEventRecord{{SNS: events.SNSEntity{Message: string(msg)}}}}
+}
+
+func newHandler(t *testing.T, srv *machineService) (*handler, *fakeAutoScaling) {
+	path := talostest.Serve(t, srv)
+	asg := &fakeAutoScaling{}
+
+	return &handler{
+		ec2:         fakeEC2{},
+		autoscaling: asg,
+		secrets:     fakeSecrets{},
+		connect: func(ctx context.Context, endpoints []string) (maintenanceClient, error) {
+			return talostest.Connect(ctx, path)
+		},
+		retryInterval: 10 * time.Millisecond,
+	}, asg
+}
+
+func TestProvision(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int
+	}{
+		{name: "maintenance API up"},
+		{name: "maintenance API coming up", failures: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := &machineService{failures: tt.failures}
+			h, asg := newHandler(t, srv)
+
+			if err := h.handle(context.Background(), launching(t)); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(srv.applied) != 1 {
+				t.Fatalf("applied %d configs, want 1", len(srv.applied))
+			}
+			if got := string(srv.applied[0].GetData()); got != machineConfig {
+				t.Errorf("applied config %q, want the secret's %q", got, machineConfig)
+			}
+			if srv.applied[0].GetMode() != machineapi.ApplyConfigurationRequest_AUTO {
+				t.Errorf("apply mode = %s, want AUTO", srv.applied[0].GetMode())
+			}
+			if len(asg.results) != 1 || asg.results[0] != "CONTINUE" {
+				t.Errorf("lifecycle results = %v, want [CONTINUE]", asg.results)
+			}
+		})
+	}
+}
+
+func TestProvisionAbandonsAtDeadline(t *testing.T) {
+	srv := &machineService{failures: -1}
+	h, asg := newHandler(t, srv)
+
+	// Leaves 200ms of retries before the retry margin
+	ctx, cancel := context.WithTimeout(context.Background(), retryMargin+200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if err := h.handle(ctx, launching(t)); err == nil {
+		t.Fatal("expected an error once the deadline is reached")
+	}
+
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond || elapsed > retryMargin {
+		t.Errorf("gave up after %s, want to retry until the retry margin", elapsed)
+	}
+	if len(srv.applied) != 0 {
+		t.Errorf("applied %d configs to an unreachable node", len(srv.applied))
+	}
+	if len(asg.results) != 1 || asg.results[0] != "ABANDON" {
+		t.Errorf("lifecycle results = %v, want [ABANDON]", asg.results)
+	}
+}
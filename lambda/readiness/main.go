@@ -0,0 +1,277 @@
+// Command readiness sends CloudFormation signals for the nodes of autoscaling groups with a creation
+// policy. Talos nodes can't run cfn-signal themselves, so the handler runs on a schedule, checks every
+// in-service node of the groups that are being created or updated, as a replacement group waits for
+// signals as well, and signals the ready ones with their instance ID. Once no group waits for signals
+// and the stack is done, it disables the schedules that invoke it.
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
+	cfntypes "github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/cosi-project/runtime/pkg/safe"
+	"github.com/siderolabs/talos/pkg/machinery/client"
+	"github.com/siderolabs/talos/pkg/machinery/resources/k8s"
+	"google.golang.org/grpc"
+
+	"github.com/steveyackey/taloscdk/lambda/internal/nodes"
+	"github.com/steveyackey/taloscdk/lambda/internal/talosapi"
+)
+
+const (
+	// checkTalos waits for the Talos API to answer and the kubelet service to be healthy
+	checkTalos = "talos"
+
+	// checkKubernetes waits for the node to be Ready in Kubernetes, as seen by Talos
+	checkKubernetes = "kubernetes"
+)
+
+// cloudFormation is the subset of the CloudFormation API used by the handler. *cloudformation.Client satisfies it.
+type cloudFormation interface {
+	DescribeStackResource(ctx context.Context, params *cloudformation.DescribeStackResourceInput, optFns ...func(*cloudformation.Options)) (*cloudformation.DescribeStackResourceOutput, error)
+	DescribeStacks(ctx context.Context, params *cloudformation.DescribeStacksInput, optFns ...func(*cloudformation.Options)) (*cloudformation.DescribeStacksOutput, error)
+	SignalResource(ctx context.Context, params *cloudformation.SignalResourceInput, optFns ...func(*cloudformation.Options)) (*cloudformation.SignalResourceOutput, error)
+}
+
+// eventBridge is the subset of the EventBridge API used by the handler. *eventbridge.Client satisfies it.
+type eventBridge interface {
+	ListRuleNamesByTarget(ctx context.Context, params *eventbridge.ListRuleNamesByTargetInput, optFns ...func(*eventbridge.Options)) (*eventbridge.ListRuleNamesByTargetOutput, error)
+	DisableRule(ctx context.Context, params *eventbridge.DisableRuleInput, optFns ...func(*eventbridge.Options)) (*eventbridge.DisableRuleOutput, error)
+}
+
+// talosClient is the subset of the Talos API used by the handler
+type talosClient interface {
+	ServiceInfo(ctx context.Context, id string, callOptions ...grpc.CallOption) ([]client.ServiceInfo, error)
+	NodeReady(ctx context.Context) (bool, error)
+	Close() error
+}
+
+// talosNode adds the Kubernetes node status to *client.Client
+type talosNode struct {
+	*client.Client
+}
+
+// NodeReady reports whether Talos sees its own Kubernetes node as Ready
+func (n talosNode) NodeReady(ctx context.Context) (bool, error) {
+	statuses, err := safe.StateListAll[*k8s.NodeStatus](ctx, n.COSI)
+	if err != nil {
+		return false, fmt.Errorf("listing node statuses: %w", err)
+	}
+
+	_, ready := statuses.Find(func(status *k8s.NodeStatus) bool {
+		return status.TypedSpec().NodeReady
+	})
+	return ready, nil
+}
+
+type handler struct {
+	cloudformation cloudFormation
+	ec2            nodes.EC2
+	autoscaling    nodes.AutoScaling
+	events         eventBridge
+
+	// stack and logicalIDs identify the autoscaling groups to signal
+	stack      string
+	logicalIDs []string
+
+	// check is checkTalos or checkKubernetes
+	check string
+
+	// connect opens a Talos API client for the given endpoints
+	connect func(ctx context.Context, endpoints []string) (talosClient, error)
+}
+
+func (h *handler) handle(ctx context.Context) error {
+	groups, waiting, err := h.waitingGroups(ctx)
+	if err != nil {
+		return err
+	}
+
+	if !waiting {
+		// The schedule is enabled again before the groups are updated, keep it until they start waiting
+		busy, err := h.stackInProgress(ctx)
+		if err != nil || busy {
+			return err
+		}
+		return h.disableSchedules(ctx)
+	}
+
+	for logicalID, name := range groups {
+		instances, err := nodes.InService(ctx, h.autoscaling, h.ec2, []string{name})
+		if err != nil {
+			return err
+		}
+
+		for _, instance := range instances {
+			if instance.PrivateIP == "" {
+				continue
+			}
+
+			ready, err := h.ready(ctx, instance.PrivateIP)
+			if err != nil {
+				// Nodes are expected to be unreachable while booting
+				log.Printf("%s (%s): %v", instance.ID, instance.PrivateIP, err)
+				continue
+			}
+			if !ready {
+				log.Printf("%s (%s): not ready yet", instance.ID, instance.PrivateIP)
+				continue
+			}
+
+			_, err = h.cloudformation.SignalResource(ctx, &cloudformation.SignalResourceInput{
+				StackName:         aws.String(h.stack),
+				LogicalResourceId: aws.String(logicalID),
+				UniqueId:          aws.String(instance.ID),
+				Status:            cfntypes.ResourceSignalStatusSuccess,
+			})
+			if err != nil {
+				// Signals for an instance that was already counted are rejected, which is fine
+				log.Printf("%s: signaling %s: %v", instance.ID, logicalID, err)
+				continue
+			}
+			log.Printf("%s: signaled %s", instance.ID, logicalID)
+		}
+	}
+
+	return nil
+}
+
+// waitingGroups returns the names of the watched autoscaling groups that may be waiting for signals, by
+// logical ID: groups being created, and groups being updated, which may be a replacement with the creation
+// policy. Groups that are done no longer accept signals and are skipped.
+// waiting is false once all groups exist and none of them is being created or updated.
+func (h *handler) waitingGroups(ctx context.Context) (groups map[string]string, waiting bool, err error) {
+	groups = map[string]string{}
+	for _, id := range h.logicalIDs {
+		out, err := h.cloudformation.DescribeStackResource(ctx, &cloudformation.DescribeStackResourceInput{
+			StackName:         aws.String(h.stack),
+			LogicalResourceId: aws.String(id),
+		})
+		if err != nil {
+			return nil, false, fmt.Errorf("describing %s in stack %s: %w", id, h.stack, err)
+		}
+
+		resource := out.StackResourceDetail
+		if resource.ResourceStatus != cfntypes.ResourceStatusCreateInProgress && resource.ResourceStatus != cfntypes.ResourceStatusUpdateInProgress {
+			continue
+		}
+
+		waiting = true
+		if aws.ToString(resource.PhysicalResourceId) != "" {
+			groups[id] = aws.ToString(resource.PhysicalResourceId)
+		}
+	}
+	return groups, waiting, nil
+}
+
+// stackInProgress reports whether the stack is being created or updated
+func (h *handler) stackInProgress(ctx context.Context) (bool, error) {
+	out, err := h.cloudformation.DescribeStacks(ctx, &cloudformation.DescribeStacksInput{StackName: aws.String(h.stack)})
+	if err != nil {
+		return false, fmt.Errorf("describing stack %s: %w", h.stack, err)
+	}
+	if len(out.Stacks) == 0 {
+		return false, fmt.Errorf("stack %s not found", h.stack)
+	}
+
+	return strings.HasSuffix(string(out.Stacks[0].StackStatus), "_IN_PROGRESS"), nil
+}
+
+// disableSchedules disables the rules that invoke the function, so it stops running once there is
+// nothing left to signal
+func (h *handler) disableSchedules(ctx context.Context) error {
+	lc, ok := lambdacontext.FromContext(ctx)
+	if !ok {
+		return fmt.Errorf("no Lambda context to find the function's schedules")
+	}
+
+	out, err := h.events.ListRuleNamesByTarget(ctx, &eventbridge.ListRuleNamesByTargetInput{
+		TargetArn: aws.String(lc.InvokedFunctionArn),
+	})
+	if err != nil {
+		return fmt.Errorf("listing the schedules of %s: %w", lc.InvokedFunctionArn, err)
+	}
+
+	for _, name := range out.RuleNames {
+		_, err := h.events.DisableRule(ctx, &eventbridge.DisableRuleInput{Name: aws.String(name)})
+		if err != nil {
+			return fmt.Errorf("disabling schedule %s: %w", name, err)
+		}
+		log.Printf("no group waits for signals, disabled schedule %s", name)
+	}
+	return nil
+}
+
+// ready runs the configured check against a single node
+func (h *handler) ready(ctx context.Context, endpoint string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Second)
+	defer cancel()
+
+	c, err := h.connect(ctx, []string{endpoint})
+	if err != nil {
+		return false, err
+	}
+	defer c.Close()
+
+	if h.check == checkKubernetes {
+		return c.NodeReady(ctx)
+	}
+
+	services, err := c.ServiceInfo(ctx, "kubelet")
+	if err != nil {
+		return false, fmt.Errorf("getting kubelet service status: %w", err)
+	}
+
+	for _, svc := range services {
+		if svc.Service.GetState() == "Running" && svc.Service.GetHealth().GetHealthy() {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func main() {
+	ctx := context.Background()
+
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		log.Fatalf("loading AWS config: %v", err)
+	}
+
+	talosconfig, err := talosapi.LoadTalosconfig(ctx, secretsmanager.NewFromConfig(cfg))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	h := &handler{
+		cloudformation: cloudformation.NewFromConfig(cfg),
+		ec2:            ec2.NewFromConfig(cfg),
+		autoscaling:    autoscaling.NewFromConfig(cfg),
+		events:         eventbridge.NewFromConfig(cfg),
+		stack:          os.Getenv("STACK_NAME"),
+		logicalIDs:     strings.Split(os.Getenv("ASG_LOGICAL_IDS"), ","),
+		check:          os.Getenv("READINESS_CHECK"),
+		connect: func(ctx context.Context, endpoints []string) (talosClient, error) {
+			c, err := talosapi.Connect(ctx, talosconfig, endpoints)
+			if err != nil {
+				return nil, err
+			}
+			return talosNode{c}, nil
+		},
+	}
+	lambda.Start(h.handle)
+}
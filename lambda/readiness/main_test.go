@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	astypes "github.com/aws/aws-sdk-go-v2/service/autoscaling/types"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
+	cfntypes "github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	machineapi "github.com/siderolabs/talos/pkg/machinery/api/machine"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/steveyackey/taloscdk/lambda/internal/talostest"
+)
+
+// machineService is a Talos API stand-in reporting the kubelet service
+type machineService struct {
+	machineapi.UnimplementedMachineServiceServer
+
+	kubeletState   string
+	kubeletHealthy bool
+}
+
+func (s *machineService) ServiceList(context.Context, *emptypb.Empty) (*machineapi.ServiceListResponse, error) {
+	return &machineapi.ServiceListResponse{Messages: []*machineapi.ServiceList{{Services: []*machineapi.ServiceInfo{{
+		Id:     "kubelet",
+		State:  s.kubeletState,
+		Health: &machineapi.ServiceHealth{Healthy: s.kubeletHealthy},
+	}}}}}, nil
+}
+
+// fakeCloudFormation reports the status of the watched groups and records signals
+type fakeCloudFormation struct {
+	groups      map[string]cfntypes.ResourceStatus
+	stackStatus cfntypes.StackStatus
+
+	signals []string
+}
+
+func (f *fakeCloudFormation) DescribeStackResource(_ context.Context, params *cloudformation.DescribeStackResourceInput, _ ...func(*cloudformation.Options)) (*cloudformation.DescribeStackResourceOutput, error) {
+	id := aws.ToString(params.LogicalResourceId)
+	return &cloudformation.DescribeStackResourceOutput{StackResourceDetail: &cfntypes.StackResourceDetail{
+		LogicalResourceId:  aws.String(id),
+		PhysicalResourceId: aws.String(id + "-asg"),
+		ResourceStatus:     f.groups[id],
+	}}, nil
+}
+
+func (f *fakeCloudFormation) DescribeStacks(context.Context, *cloudformation.DescribeStacksInput, ...func(*cloudformation.Options)) (*cloudformation.DescribeStacksOutput, error) {
+	return &cloudformation.DescribeStacksOutput{Stacks: []cfntypes.Stack{{StackStatus: f.stackStatus}}}, nil
+}
+
+func (f *fakeCloudFormation) SignalResource(_ context.Context, params *cloudformation.SignalResourceInput, _ ...func(*cloudformation.Options)) (*cloudformation.SignalResourceOutput, error) {
+	f.signals = append(f.signals, aws.ToString(params.LogicalResourceId)+"/"+aws.ToString(params.UniqueId))
+	return &cloudformation.SignalResourceOutput{}, nil
+}
+
+// fakeNodes reports one in-service instance per group
+type fakeNodes struct{}
+
+func (fakeNodes) DescribeAutoScalingGroups(_ context.Context, params *autoscaling.DescribeAutoScalingGroupsInput, _ ...func(*autoscaling.Options)) (*autoscaling.DescribeAutoScalingGroupsOutput, error) {
+	name := params.AutoScalingGroupNames[0]
+	return &autoscaling.DescribeAutoScalingGroupsOutput{AutoScalingGroups: []astypes.AutoScalingGroup{{
+		Instances: []astypes.Instance{{InstanceId: aws.String("i-" + name), LifecycleState: astypes.LifecycleStateInService}},
+	}}}, nil
+}
+
+func (fakeNodes) DescribeInstances(_ context.Context, params *ec2.DescribeInstancesInput, _ ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
+	return &ec2.DescribeInstancesOutput{Reservations: []ec2types.Reservation{{Instances: []ec2types.Instance{{
+		InstanceId:       aws.String(params.InstanceIds[0]),
+		PrivateIpAddress: aws.String("10.0.1.10"),
+	}}}}}, nil
+}
+
+// fakeEvents lists a single schedule and records disabled rules
+type fakeEvents struct {
+	disabled []string
+}
+
+func (*fakeEvents) ListRuleNamesByTarget(context.Context, *eventbridge.ListRuleNamesByTargetInput, ...func(*eventbridge.Options)) (*eventbridge.ListRuleNamesByTargetOutput, error) {
+	return &eventbridge.ListRuleNamesByTargetOutput{RuleNames: []string{"readiness-schedule"}}, nil
+}
+
+func (e *fakeEvents) DisableRule(_ context.Context, params *eventbridge.DisableRuleInput, _ ...func(*eventbridge.Options)) (*eventbridge.DisableRuleOutput, error) {
+	e.disabled = append(e.disabled, aws.ToString(params.Name))
+	return &eventbridge.DisableRuleOutput{}, nil
+}
+
+func newHandler(t *testing.T, srv *machineService, cfn *fakeCloudFormation) (*handler, *fakeEvents) {
+	path := talostest.Serve(t, srv)
+	events := &fakeEvents{}
+
+	return &handler{
+		cloudformation: cfn,
+		ec2:            fakeNodes{},
+		autoscaling:    fakeNodes{},
+		events:         events,
+		stack:          "talos",
+		logicalIDs:     []string{"TalosCP0", "TalosCP1"},
+		check:          checkTalos,
+		connect: func(ctx context.Context, endpoints []string) (talosClient, error) {
+			c, err := talostest.Connect(ctx, path)
+			if err != nil {
+				return nil, err
+			}
+			return talosNode{c}, nil
+		},
+	}, events
+}
+
+func invocation() context.Context {
+	return lambdacontext.NewContext(context.Background(), &lambdacontext.LambdaContext{
+		InvokedFunctionArn: "arn:aws:lambda:us-east-1:123456789012:function:readiness",
+	})
+}
+
+func TestSignal(t *testing.T) {
+	tests := []struct {
+		name    string
+		groups  map[string]cfntypes.ResourceStatus
+		ready   bool
+		signals []string
+	}{
+		{
+			name:    "creating",
+			groups:  map[string]cfntypes.ResourceStatus{"TalosCP0": cfntypes.ResourceStatusCreateInProgress, "TalosCP1": cfntypes.ResourceStatusCreateComplete},
+			ready:   true,
+			signals: []string{"TalosCP0/i-TalosCP0-asg"},
+		},
+		{
+			name:    "replacing",
+			groups:  map[string]cfntypes.ResourceStatus{"TalosCP0": cfntypes.ResourceStatusUpdateComplete, "TalosCP1": cfntypes.ResourceStatusUpdateInProgress},
+			ready:   true,
+			signals: []string{"TalosCP1/i-TalosCP1-asg"},
+		},
+		{
+			name:   "not ready",
+			groups: map[string]cfntypes.ResourceStatus{"TalosCP0": cfntypes.ResourceStatusCreateInProgress, "TalosCP1": cfntypes.ResourceStatusCreateInProgress},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := &machineService{kubeletState: "Running", kubeletHealthy: tt.ready}
+			cfn := &fakeCloudFormation{groups: tt.groups, stackStatus: cfntypes.StackStatusCreateInProgress}
+			h, events := newHandler(t, srv, cfn)
+
+			if err := h.handle(invocation()); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(cfn.signals) != len(tt.signals) || (len(tt.signals) > 0 && cfn.signals[0] != tt.signals[0]) {
+				t.Errorf("signals = %v, want %v", cfn.signals, tt.signals)
+			}
+			if len(events.disabled) != 0 {
+				t.Errorf("disabled %v while a group waits for signals", events.disabled)
+			}
+		})
+	}
+}
+
+func TestDisableSchedules(t *testing.T) {
+	tests := []struct {
+		name        string
+		stackStatus cfntypes.StackStatus
+		disabled    bool
+	}{
+		{name: "stack done", stackStatus: cfntypes.StackStatusUpdateComplete, disabled: true},
+		{name: "stack updating", stackStatus: cfntypes.StackStatusUpdateInProgress},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfn := &fakeCloudFormation{
+				groups:      map[string]cfntypes.ResourceStatus{"TalosCP0": cfntypes.ResourceStatusCreateComplete, "TalosCP1": cfntypes.ResourceStatusUpdateComplete},
+				stackStatus: tt.stackStatus,
+			}
+			h, events := newHandler(t, &machineService{}, cfn)
+
+			if err := h.handle(invocation()); err != nil {
+				t.Fatal(err)
+			}
+
+			if disabled := len(events.disabled) == 1 && events.disabled[0] == "readiness-schedule"; disabled != tt.disabled {
+				t.Errorf("disabled %v, want disabled: %t", events.disabled, tt.disabled)
+			}
+			if len(cfn.signals) != 0 {
+				t.Errorf("signaled %v without a waiting group", cfn.signals)
+			}
+		})
+	}
+}
@@ -0,0 +1,328 @@
+// Command registryauth keeps the ECR credentials of Talos image mirrors fresh. ECR only accepts
+// authorization tokens that expire after 12 hours, so the handler runs on a schedule and patches a
+// token into machine.registries.config of every running node of the cluster that doesn't have it yet.
+// The token is cached in a secret and only renewed when it gets close to expiring, so nodes only get
+// a new config a few times a day, while new nodes get the current token on the next run.
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/cosi-project/runtime/pkg/safe"
+	machineapi "github.com/siderolabs/talos/pkg/machinery/api/machine"
+	"github.com/siderolabs/talos/pkg/machinery/client"
+	machineconfig "github.com/siderolabs/talos/pkg/machinery/config"
+	"github.com/siderolabs/talos/pkg/machinery/config/configpatcher"
+	configres "github.com/siderolabs/talos/pkg/machinery/resources/config"
+	"google.golang.org/grpc"
+	"gopkg.in/yaml.v3"
+
+	"github.com/steveyackey/taloscdk/lambda/internal/nodes"
+	"github.com/steveyackey/taloscdk/lambda/internal/talosapi"
+)
+
+const (
+	// clusterTagEnv is the tag key identifying the nodes of the cluster, kubernetes.io/cluster/<name>
+	clusterTagEnv = "CLUSTER_TAG"
+
+	// tokenCacheEnv is the ARN of the secret caching the current token
+	tokenCacheEnv = "TOKEN_CACHE_SECRET_ARN"
+
+	// refreshIntervalEnv is the schedule of the function in seconds
+	refreshIntervalEnv = "REFRESH_INTERVAL"
+)
+
+// registry is the subset of the ECR API used by the handler. *ecr.Client satisfies it.
+type registry interface {
+	GetAuthorizationToken(ctx context.Context, params *ecr.GetAuthorizationTokenInput, optFns ...func(*ecr.Options)) (*ecr.GetAuthorizationTokenOutput, error)
+}
+
+// tokenCache is the subset of the Secrets Manager API used by the handler. *secretsmanager.Client satisfies it.
+type tokenCache interface {
+	GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error)
+	PutSecretValue(ctx context.Context, params *secretsmanager.PutSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.PutSecretValueOutput, error)
+}
+
+// token is an ECR authorization token, as stored in the token cache
+type token struct {
+	Host      string    `json:"host"`
+	Username  string    `json:"username"`
+	Password  string    `json:"password"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// talosClient is the subset of the Talos API used by the handler
+type talosClient interface {
+	MachineConfig(ctx context.Context) (machineconfig.Provider, error)
+	ApplyConfiguration(ctx context.Context, req *machineapi.ApplyConfigurationRequest, callOptions ...grpc.CallOption) (*machineapi.ApplyConfigurationResponse, error)
+	Close() error
+}
+
+// talosNode adds reading the active machine config to *client.Client
+type talosNode struct {
+	*client.Client
+}
+
+// MachineConfig returns the machine config the node is running with
+func (n talosNode) MachineConfig(ctx context.Context) (machineconfig.Provider, error) {
+	cfg, err := safe.StateGetByID[*configres.MachineConfig](ctx, n.COSI, configres.ActiveID)
+	if err != nil {
+		return nil, fmt.Errorf("reading machine config: %w", err)
+	}
+
+	return cfg.Provider(), nil
+}
+
+type handler struct {
+	ecr   registry
+	ec2   nodes.EC2
+	cache tokenCache
+
+	// clusterTag selects the nodes to update
+	clusterTag string
+
+	// tokenCache is the ARN of the secret caching the current token
+	tokenCache string
+
+	// renewBefore is how long before it expires the cached token is replaced. It has to leave
+	// time for at least one more run.
+	renewBefore time.Duration
+
+	// connect opens a Talos API client for the given endpoints
+	connect func(ctx context.Context, endpoints []string) (talosClient, error)
+}
+
+func (h *handler) handle(ctx context.Context) error {
+	tok, err := h.token(ctx)
+	if err != nil {
+		return err
+	}
+
+	patch, err := authPatch(tok)
+	if err != nil {
+		return err
+	}
+
+	instances, err := nodes.Tagged(ctx, h.ec2, h.clusterTag)
+	if err != nil {
+		return err
+	}
+
+	var failed int
+	for _, instance := range instances {
+		if instance.PrivateIP == "" {
+			continue
+		}
+
+		updated, err := h.update(ctx, instance.PrivateIP, tok, patch)
+		if err != nil {
+			// Nodes that are still booting get the credentials on the next run
+			log.Printf("%s (%s): %v", instance.ID, instance.PrivateIP, err)
+			failed++
+			continue
+		}
+		if updated {
+			log.Printf("%s (%s): refreshed credentials for %s", instance.ID, instance.PrivateIP, tok.Host)
+		}
+	}
+
+	if failed > 0 && failed == len(instances) {
+		return fmt.Errorf("refreshing credentials failed on all %d nodes", failed)
+	}
+	return nil
+}
+
+// token returns the cached token, or a new one if it expires within renewBefore
+func (h *handler) token(ctx context.Context) (token, error) {
+	var cached token
+
+	out, err := h.cache.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{SecretId: aws.String(h.tokenCache)})
+	if err != nil {
+		return token{}, fmt.Errorf("reading token cache %s: %w", h.tokenCache, err)
+	}
+
+	// The secret starts out with a generated value that isn't a token
+	if err := json.Unmarshal([]byte(aws.ToString(out.SecretString)), &cached); err == nil && time.Until(cached.ExpiresAt) > h.renewBefore {
+		return cached, nil
+	}
+
+	tok, err := h.newToken(ctx)
+	if err != nil {
+		return token{}, err
+	}
+
+	value, err := json.Marshal(tok)
+	if err != nil {
+		return token{}, err
+	}
+
+	_, err = h.cache.PutSecretValue(ctx, &secretsmanager.PutSecretValueInput{
+		SecretId:     aws.String(h.tokenCache),
+		SecretString: aws.String(string(value)),
+	})
+	if err != nil {
+		return token{}, fmt.Errorf("caching token in %s: %w", h.tokenCache, err)
+	}
+
+	log.Printf("renewed token for %s, expires at %s", tok.Host, tok.ExpiresAt)
+	return tok, nil
+}
+
+// newToken gets a new authorization token of the account's ECR
+func (h *handler) newToken(ctx context.Context) (token, error) {
+	out, err := h.ecr.GetAuthorizationToken(ctx, &ecr.GetAuthorizationTokenInput{})
+	if err != nil {
+		return token{}, fmt.Errorf("getting ECR authorization token: %w", err)
+	}
+	if len(out.AuthorizationData) == 0 {
+		return token{}, fmt.Errorf("ECR returned no authorization data")
+	}
+
+	data := out.AuthorizationData[0]
+	decoded, err := base64.StdEncoding.DecodeString(aws.ToString(data.AuthorizationToken))
+	if err != nil {
+		return token{}, fmt.Errorf("decoding ECR authorization token: %w", err)
+	}
+
+	username, password, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return token{}, fmt.Errorf("ECR authorization token is not username:password")
+	}
+
+	return token{
+		Host:      strings.TrimPrefix(aws.ToString(data.ProxyEndpoint), "https://"),
+		Username:  username,
+		Password:  password,
+		ExpiresAt: aws.ToTime(data.ExpiresAt),
+	}, nil
+}
+
+// authPatch returns a machine config patch with tok as the credentials of its registry
+func authPatch(tok token) (configpatcher.Patch, error) {
+	raw, err := yaml.Marshal(map[string]interface{}{
+		"machine": map[string]interface{}{
+			"registries": map[string]interface{}{
+				"config": map[string]interface{}{
+					tok.Host: map[string]interface{}{
+						"auth": map[string]interface{}{
+							"username": tok.Username,
+							"password": tok.Password,
+						},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	patch, err := configpatcher.LoadPatch(raw)
+	if err != nil {
+		return nil, fmt.Errorf("loading registry auth patch: %w", err)
+	}
+
+	return patch, nil
+}
+
+// update patches the machine config of the node at endpoint, unless it already has tok.
+// Registry changes don't need a reboot.
+func (h *handler) update(ctx context.Context, endpoint string, tok token, patch configpatcher.Patch) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	c, err := h.connect(ctx, []string{endpoint})
+	if err != nil {
+		return false, err
+	}
+	defer c.Close()
+
+	current, err := c.MachineConfig(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	if registry, ok := current.Machine().Registries().Config()[tok.Host]; ok {
+		if auth := registry.Auth(); auth != nil && auth.Username() == tok.Username && auth.Password() == tok.Password {
+			return false, nil
+		}
+	}
+
+	patched, err := configpatcher.Apply(configpatcher.WithConfig(current), []configpatcher.Patch{patch})
+	if err != nil {
+		return false, fmt.Errorf("patching machine config: %w", err)
+	}
+
+	data, err := patched.Bytes()
+	if err != nil {
+		return false, fmt.Errorf("encoding machine config: %w", err)
+	}
+
+	_, err = c.ApplyConfiguration(ctx, &machineapi.ApplyConfigurationRequest{
+		Data: data,
+		Mode: machineapi.ApplyConfigurationRequest_NO_REBOOT,
+	})
+	if err != nil {
+		return false, fmt.Errorf("applying machine config: %w", err)
+	}
+
+	return true, nil
+}
+
+func main() {
+	ctx := context.Background()
+
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		log.Fatalf("loading AWS config: %v", err)
+	}
+
+	sm := secretsmanager.NewFromConfig(cfg)
+
+	talosconfig, err := talosapi.LoadTalosconfig(ctx, sm)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	interval, err := strconv.Atoi(os.Getenv(refreshIntervalEnv))
+	if err != nil {
+		log.Fatalf("parsing %s: %v", refreshIntervalEnv, err)
+	}
+
+	// Renew the token early enough for two more runs, and at least an hour before it expires
+	renewBefore := 2 * time.Duration(interval) * time.Second
+	if renewBefore < time.Hour {
+		renewBefore = time.Hour
+	}
+
+	h := &handler{
+		ecr:         ecr.NewFromConfig(cfg),
+		ec2:         ec2.NewFromConfig(cfg),
+		cache:       sm,
+		clusterTag:  os.Getenv(clusterTagEnv),
+		tokenCache:  os.Getenv(tokenCacheEnv),
+		renewBefore: renewBefore,
+		connect: func(ctx context.Context, endpoints []string) (talosClient, error) {
+			c, err := talosapi.Connect(ctx, talosconfig, endpoints)
+			if err != nil {
+				return nil, err
+			}
+			return talosNode{c}, nil
+		},
+	}
+	lambda.Start(h.handle)
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	ecrtypes "github.com/aws/aws-sdk-go-v2/service/ecr/types"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	machineapi "github.com/siderolabs/talos/pkg/machinery/api/machine"
+	"github.com/siderolabs/talos/pkg/machinery/client"
+	machineconfig "github.com/siderolabs/talos/pkg/machinery/config"
+	"github.com/siderolabs/talos/pkg/machinery/config/configloader"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gopkg.in/yaml.v3"
+
+	"github.com/steveyackey/taloscdk/lambda/internal/talostest"
+)
+
+const registryHost = "123456789012.dkr.ecr.us-east-1.amazonaws.com"
+
+// nodeConfig is a worker config with credentials for another registry
+const nodeConfig = `version: v1alpha1
+machine:
+  type: worker
+  token: abcdef.0123456789abcdef
+  ca:
+    crt: ""
+    key: ""
+  certSANs: []
+  registries:
+    config:
+      registry.example.com:
+        auth:
+          username: other
+          password: secret
+cluster:
+  controlPlane:
+    endpoint: https://talos.cluster:6443
+  clusterName: talos
+  network:
+    dnsDomain: cluster.local
+    podSubnets:
+      - 10.244.0.0/16
+    serviceSubnets:
+      - 10.96.0.0/12
+`
+
+// machineService is a Talos API stand-in recording the applied configs
+type machineService struct {
+	machineapi.UnimplementedMachineServiceServer
+
+	applyErr error
+	applied  [][]byte
+}
+
+func (s *machineService) ApplyConfiguration(_ context.Context, req *machineapi.ApplyConfigurationRequest) (*machineapi.ApplyConfigurationResponse, error) {
+	if s.applyErr != nil {
+		return nil, s.applyErr
+	}
+	s.applied = append(s.applied, req.GetData())
+	return &machineapi.ApplyConfigurationResponse{Messages: []*machineapi.ApplyConfiguration{{}}}, nil
+}
+
+// fakeNode reads the machine config from cfg instead of the COSI API, which talostest doesn't serve
+type fakeNode struct {
+	*client.Client
+	cfg machineconfig.Provider
+}
+
+func (n fakeNode) MachineConfig(context.Context) (machineconfig.Provider, error) {
+	return n.cfg, nil
+}
+
+// fakeECR hands out tokens for registryHost
+type fakeECR struct {
+	calls int
+}
+
+func (r *fakeECR) GetAuthorizationToken(context.Context, *ecr.GetAuthorizationTokenInput, ...func(*ecr.Options)) (*ecr.GetAuthorizationTokenOutput, error) {
+	r.calls++
+	return &ecr.GetAuthorizationTokenOutput{AuthorizationData: []ecrtypes.AuthorizationData{{
+		AuthorizationToken: aws.String(base64.StdEncoding.EncodeToString([]byte("AWS:fresh"))),
+		ProxyEndpoint:      aws.String("https://" + registryHost),
+		ExpiresAt:          aws.Time(time.Now().Add(12 * time.Hour)),
+	}}}, nil
+}
+
+// fakeCache is the token cache secret
+type fakeCache struct {
+	value string
+	puts  int
+}
+
+func (c *fakeCache) GetSecretValue(context.Context, *secretsmanager.GetSecretValueInput, ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
+	return &secretsmanager.GetSecretValueOutput{SecretString: aws.String(c.value)}, nil
+}
+
+func (c *fakeCache) PutSecretValue(_ context.Context, params *secretsmanager.PutSecretValueInput, _ ...func(*secretsmanager.Options)) (*secretsmanager.PutSecretValueOutput, error) {
+	c.value = aws.ToString(params.SecretString)
+	c.puts++
+	return &secretsmanager.PutSecretValueOutput{}, nil
+}
+
+// fakeEC2 reports two running nodes
+type fakeEC2 struct{}
+
+func (fakeEC2) DescribeInstances(context.Context, *ec2.DescribeInstancesInput, ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
+	return &ec2.DescribeInstancesOutput{Reservations: []ec2types.Reservation{{Instances: []ec2types.Instance{
+		{InstanceId: aws.String("i-a"), PrivateIpAddress: aws.String("10.0.1.10")},
+		{InstanceId: aws.String("i-b"), PrivateIpAddress: aws.String("10.0.1.11")},
+	}}}}, nil
+}
+
+func cachedToken(t *testing.T, tok token) string {
+	value, err := json.Marshal(tok)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(value)
+}
+
+func loadConfig(t *testing.T, raw string) machineconfig.Provider {
+	cfg, err := configloader.NewFromBytes([]byte(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+// newHandler serves one Talos API stand-in per node address, all running cfg
+func newHandler(t *testing.T, cache *fakeCache, cfg machineconfig.Provider, nodes map[string]*machineService) (*handler, *fakeECR) {
+	paths := map[string]string{}
+	for ip, srv := range nodes {
+		paths[ip] = talostest.Serve(t, srv)
+	}
+	registry := &fakeECR{}
+
+	return &handler{
+		ecr:         registry,
+		ec2:         fakeEC2{},
+		cache:       cache,
+		clusterTag:  "kubernetes.io/cluster/talos",
+		tokenCache:  "token-cache",
+		renewBefore: time.Hour,
+		connect: func(ctx context.Context, endpoints []string) (talosClient, error) {
+			c, err := talostest.Connect(ctx, paths[endpoints[0]])
+			if err != nil {
+				return nil, err
+			}
+			return fakeNode{Client: c, cfg: cfg}, nil
+		},
+	}, registry
+}
+
+func TestToken(t *testing.T) {
+	tests := []struct {
+		name    string
+		cached  string
+		renewed bool
+	}{
+		{name: "cached", cached: cachedToken(t, token{Host: registryHost, Username: "AWS", Password: "cached", ExpiresAt: time.Now().Add(6 * time.Hour)})},
+		{name: "expiring", cached: cachedToken(t, token{Host: registryHost, Username: "AWS", Password: "cached", ExpiresAt: time.Now().Add(30 * time.Minute)}), renewed: true},
+		{name: "generated secret value", cached: "not a token", renewed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := &fakeCache{value: tt.cached}
+			h, registry := newHandler(t, cache, loadConfig(t, nodeConfig), nil)
+
+			tok, err := h.token(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := "cached"
+			if tt.renewed {
+				want = "fresh"
+			}
+			if tok.Password != want {
+				t.Errorf("token password = %q, want %q", tok.Password, want)
+			}
+			if renewed := registry.calls > 0 || cache.puts > 0; renewed != tt.renewed {
+				t.Errorf("ECR calls = %d, cache puts = %d, want renewed = %v", registry.calls, cache.puts, tt.renewed)
+			}
+		})
+	}
+}
+
+func TestHandle(t *testing.T) {
+	a, b := &machineService{}, &machineService{}
+	cache := &fakeCache{value: "not a token"}
+	cfg := loadConfig(t, nodeConfig)
+	h, _ := newHandler(t, cache, cfg, map[string]*machineService{"10.0.1.10": a, "10.0.1.11": b})
+
+	if err := h.handle(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(a.applied) != 1 || len(b.applied) != 1 {
+		t.Fatalf("applied %d and %d configs, want one per node", len(a.applied), len(b.applied))
+	}
+
+	before, after := decode(t, cfg), decodeBytes(t, a.applied[0])
+
+	registries := func(doc map[string]interface{}) map[string]interface{} {
+		machine := doc["machine"].(map[string]interface{})
+		registries := machine["registries"].(map[string]interface{})
+		config := registries["config"].(map[string]interface{})
+		delete(registries, "config")
+		return config
+	}
+
+	gotRegistries, wantRegistries := registries(after), registries(before)
+	if !reflect.DeepEqual(before, after) {
+		t.Errorf("patch changed more than machine.registries.config:\nbefore: %v\nafter:  %v", before, after)
+	}
+
+	wantRegistries[registryHost] = map[string]interface{}{"auth": map[string]interface{}{"username": "AWS", "password": "fresh"}}
+	if !reflect.DeepEqual(gotRegistries, wantRegistries) {
+		t.Errorf("machine.registries.config = %v, want %v", gotRegistries, wantRegistries)
+	}
+}
+
+func TestHandleSkipsUpToDateNodes(t *testing.T) {
+	tok := token{Host: registryHost, Username: "AWS", Password: "cached", ExpiresAt: time.Now().Add(6 * time.Hour)}
+	upToDate := strings.Replace(nodeConfig, "    config:\n", "    config:\n      "+registryHost+":\n        auth:\n          username: AWS\n          password: cached\n", 1)
+
+	a := &machineService{}
+	h, _ := newHandler(t, &fakeCache{value: cachedToken(t, tok)}, loadConfig(t, upToDate), map[string]*machineService{"10.0.1.10": a, "10.0.1.11": a})
+
+	if err := h.handle(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(a.applied) != 0 {
+		t.Errorf("applied %d configs to nodes that already have the token", len(a.applied))
+	}
+}
+
+func TestHandleFailures(t *testing.T) {
+	unavailable := status.Error(codes.Unavailable, "still booting")
+
+	tests := []struct {
+		name    string
+		a, b    error
+		wantErr bool
+	}{
+		{name: "one node fails", a: unavailable},
+		{name: "all nodes fail", a: unavailable, b: unavailable, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodes := map[string]*machineService{
+				"10.0.1.10": {applyErr: tt.a},
+				"10.0.1.11": {applyErr: tt.b},
+			}
+			h, _ := newHandler(t, &fakeCache{value: "not a token"}, loadConfig(t, nodeConfig), nodes)
+
+			err := h.handle(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("handle() error = %v, want error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// decode returns the YAML document of cfg
+func decode(t *testing.T, cfg machineconfig.Provider) map[string]interface{} {
+	raw, err := cfg.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return decodeBytes(t, raw)
+}
+
+func decodeBytes(t *testing.T, raw []byte) map[string]interface{} {
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(raw, &doc); err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
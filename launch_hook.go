@@ -0,0 +1,97 @@
+package taloscdk
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-cdk-go/awscdk"
+	"github.com/aws/aws-cdk-go/awscdk/awsautoscaling"
+	"github.com/aws/aws-cdk-go/awscdk/awsiam"
+	"github.com/aws/aws-cdk-go/awscdk/awslambda"
+	"github.com/aws/aws-cdk-go/awscdk/awssns"
+	"github.com/aws/aws-cdk-go/awscdk/awssnssubscriptions"
+	"github.com/aws/jsii-runtime-go"
+	_jsii_ "github.com/aws/jsii-runtime-go/runtime"
+)
+
+// launchHooks collects the inline launch hooks of the autoscaling groups of one construct. The jsii runtime
+// can't read them back from the L1 resource, so every hook of an ASG has to be added through the same launchHooks.
+type launchHooks map[awsautoscaling.AutoScalingGroup][]*awsautoscaling.CfnAutoScalingGroup_LifecycleHookSpecificationProperty
+
+// launchHookTarget delivers launch lifecycle notifications to a function through a single SNS topic.
+//
+// Hooks added with AutoScalingGroup.AddLifecycleHook are separate resources that are only created after
+// the ASG, so the instances launched along with the ASG never see them. Launch hooks are instead part
+// of the ASG resource, and the ASG depends on the topic, role and function, which therefore must not
+// reference the ASG themselves.
+type launchHookTarget struct {
+	topic awssns.Topic
+	role  awsiam.Role
+	fn    awslambda.IFunction
+	hooks launchHooks
+}
+
+func newLaunchHookTarget(scope awscdk.Construct, id *string, fn awslambda.IFunction, hooks launchHooks) *launchHookTarget {
+	topic := awssns.NewTopic(scope, id, &awssns.TopicProps{})
+	topic.AddSubscription(awssnssubscriptions.NewLambdaSubscription(fn, nil))
+
+	role := awsiam.NewRole(scope, jsii.String(*id+"Role"), &awsiam.RoleProps{
+		AssumedBy: awsiam.NewServicePrincipal(jsii.String("autoscaling.amazonaws.com"), nil),
+	})
+	topic.GrantPublish(role)
+
+	return &launchHookTarget{topic: topic, role: role, fn: fn, hooks: hooks}
+}
+
+// add registers a launch lifecycle hook named name on asg and allows the function to complete its actions
+func (t *launchHookTarget) add(asg awsautoscaling.AutoScalingGroup, name string, metadata *string, heartbeat awscdk.Duration, result awsautoscaling.DefaultResult) {
+	var cfn awsautoscaling.CfnAutoScalingGroup
+	defaultChild(asg, &cfn)
+
+	t.hooks[asg] = append(t.hooks[asg], &awsautoscaling.CfnAutoScalingGroup_LifecycleHookSpecificationProperty{
+		LifecycleHookName:     jsii.String(name),
+		LifecycleTransition:   jsii.String("autoscaling:EC2_INSTANCE_LAUNCHING"),
+		DefaultResult:         jsii.String(string(result)),
+		HeartbeatTimeout:      heartbeat.ToSeconds(nil),
+		NotificationMetadata:  metadata,
+		NotificationTargetArn: t.topic.TopicArn(),
+		RoleArn:               t.role.RoleArn(),
+	})
+
+	hooks := t.hooks[asg]
+	cfn.SetLifecycleHookSpecificationList(&hooks)
+
+	t.fn.AddToRolePolicy(awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
+		Effect:    awsiam.Effect_ALLOW,
+		Actions:   jsii.Strings("autoscaling:CompleteLifecycleAction"),
+		Resources: &[]*string{autoScalingGroupArn(asg, cfn)},
+	}))
+
+	// The subscription and the function have to exist before the first instance launches
+	asg.Node().AddDependency(t.topic, t.role, t.fn)
+}
+
+// autoScalingGroupArn returns the ARN of asg without referencing (and depending on) the group. The group
+// gets a fixed name for that, derived from its construct path (which starts with the stack).
+func autoScalingGroupArn(asg awsautoscaling.AutoScalingGroup, cfn awsautoscaling.CfnAutoScalingGroup) *string {
+	stack := awscdk.Stack_Of(asg)
+
+	// Unnamed groups return a lazy physical name that resolves to nothing
+	name := cfn.AutoScalingGroupName()
+	if name == nil || *awscdk.Token_IsUnresolved(name) {
+		name = awscdk.Names_UniqueId(asg)
+		cfn.SetAutoScalingGroupName(name)
+	}
+
+	return stack.FormatArn(&awscdk.ArnComponents{
+		Service:      jsii.String("autoscaling"),
+		Resource:     jsii.String("autoScalingGroup"),
+		Sep:          jsii.String(":"),
+		ResourceName: jsii.String(fmt.Sprintf("*:autoScalingGroupName/%s", *name)),
+	})
+}
+
+// defaultChild stores the L1 resource of c in ret, a pointer to the Cfn type. Node().DefaultChild()
+// returns a plain IConstruct, which can't be converted to the Cfn type.
+func defaultChild(c awscdk.IConstruct, ret interface{}) {
+	_jsii_.Get(c.Node(), "defaultChild", ret)
+}
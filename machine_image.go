@@ -0,0 +1,33 @@
+package taloscdk
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-cdk-go/awscdk/awsec2"
+	"github.com/aws/jsii-runtime-go"
+)
+
+// newMachineImage returns the Talos image from the AMI map if given, otherwise looks up the
+// image by name from the Talos account. The node config is passed as the instance user data.
+func newMachineImage(ami *map[string]*string, name *string, config *string) awsec2.IMachineImage {
+	if ami != nil {
+		return awsec2.NewGenericLinuxImage(ami, &awsec2.GenericLinuxImageProps{
+			UserData: awsec2.UserData_Custom(config),
+		})
+	}
+
+	return awsec2.NewLookupMachineImage(&awsec2.LookupMachineImageProps{
+		Name:     name,
+		Owners:   jsii.Strings("540036508848"),
+		UserData: awsec2.UserData_Custom(config),
+	})
+}
+
+// requireTalosV1 panics if the image named imageName is a Talos v0.x image, which doesn't support feature.
+// AMI IDs can't be checked.
+func requireTalosV1(feature string, ami *map[string]*string, imageName *string) {
+	if ami == nil && imageName != nil && strings.HasPrefix(*imageName, "talos-v0.") {
+		panic(fmt.Sprintf("%s requires Talos v1.0 or later, set MachineImageName or MachineImageAMI to a newer image than %s", feature, *imageName))
+	}
+}
@@ -0,0 +1,140 @@
+package taloscdk
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-cdk-go/awscdk"
+	"github.com/aws/aws-cdk-go/awscdk/awsec2"
+	awselbv2 "github.com/aws/aws-cdk-go/awscdk/awselasticloadbalancingv2"
+	"github.com/aws/aws-cdk-go/awscdk/awss3"
+	"github.com/aws/constructs-go/constructs/v3"
+	"github.com/aws/jsii-runtime-go"
+)
+
+// NLBAccessLogsProps configure NLB access logs. NLBs only write access logs for TLS listeners, so they have
+// no effect on an NLB without one, like the control plane NLB with its TCP listener on 6443.
+type NLBAccessLogsProps struct {
+	// Bucket to deliver access logs to.
+	// Default: a new encrypted bucket is created with the lifecycle rules below.
+	Bucket awss3.IBucket
+
+	// Prefix for the log objects in the bucket.
+	// Default: no prefix
+	Prefix *string
+
+	// Expiration is how long log objects are kept before being deleted.
+	// Only used when the bucket is created by the construct.
+	// Default: awscdk.Duration_Days(jsii.Number(90))
+	Expiration awscdk.Duration
+
+	// TransitionToInfrequentAccess moves log objects to S3 Infrequent Access after the given duration.
+	// Only used when the bucket is created by the construct. Must be at least 30 days, and shorter than Expiration.
+	// Default: nil (no transition)
+	TransitionToInfrequentAccess awscdk.Duration
+
+	// RemovalPolicy of a bucket created by the construct.
+	// Default: awscdk.RemovalPolicy_RETAIN
+	RemovalPolicy awscdk.RemovalPolicy
+}
+
+// NewNLBAccessLogsBucket returns a bucket suitable for NLB access logs. The bucket blocks public access,
+// uses S3 managed encryption (required by ELB log delivery) and expires logs per the props.
+func NewNLBAccessLogsBucket(scope constructs.Construct, id *string, props *NLBAccessLogsProps) awss3.Bucket {
+	if props == nil {
+		props = &NLBAccessLogsProps{}
+	}
+
+	if props.Expiration == nil {
+		props.Expiration = awscdk.Duration_Days(jsii.Number(90))
+	}
+
+	if props.RemovalPolicy == "" {
+		props.RemovalPolicy = awscdk.RemovalPolicy_RETAIN
+	}
+
+	rule := &awss3.LifecycleRule{
+		Enabled:    jsii.Bool(true),
+		Prefix:     props.Prefix,
+		Expiration: props.Expiration,
+	}
+
+	if props.TransitionToInfrequentAccess != nil {
+		days := &awscdk.TimeConversionOptions{Integral: jsii.Bool(false)}
+		if *props.Expiration.ToDays(days) <= *props.TransitionToInfrequentAccess.ToDays(days) {
+			panic(fmt.Sprintf("NLBAccessLogsProps.Expiration (%s) must be longer than TransitionToInfrequentAccess (%s)",
+				*props.Expiration.ToHumanString(), *props.TransitionToInfrequentAccess.ToHumanString()))
+		}
+
+		rule.Transitions = &[]*awss3.Transition{
+			{
+				StorageClass:    awss3.StorageClass_INFREQUENT_ACCESS(),
+				TransitionAfter: props.TransitionToInfrequentAccess,
+			},
+		}
+	}
+
+	return awss3.NewBucket(scope, id, &awss3.BucketProps{
+		BlockPublicAccess: awss3.BlockPublicAccess_BLOCK_ALL(),
+		Encryption:        awss3.BucketEncryption_S3_MANAGED,
+		EnforceSSL:        jsii.Bool(true),
+		LifecycleRules:    &[]*awss3.LifecycleRule{rule},
+		RemovalPolicy:     props.RemovalPolicy,
+	})
+}
+
+// enableNLBAccessLogs turns on access logging for the NLB, creating a bucket when one isn't given.
+// ELBv2 access logging needs a concrete region on the stack (set Env on your StackProps).
+// NLBs only log TLS listeners and the control plane NLB only gets a TCP listener, so a warning
+// is added as a reminder to add a TLS listener.
+func enableNLBAccessLogs(scope constructs.Construct, nlb awselbv2.NetworkLoadBalancer, props *NLBAccessLogsProps) awss3.IBucket {
+	awscdk.Annotations_Of(nlb).AddWarning(jsii.String("NLB access logs are only written for TLS listeners. The control plane NLB only has a TCP listener on 6443, so no logs are delivered unless you add a TLS listener to it."))
+
+	if props.Bucket == nil {
+		props.Bucket = NewNLBAccessLogsBucket(scope, jsii.String("AccessLogs"), props)
+	}
+
+	nlb.LogAccessLogs(props.Bucket, props.Prefix)
+
+	return props.Bucket
+}
+
+// newKubernetesAPITargets creates the 6443 target group and its NLB listener
+func newKubernetesAPITargets(scope constructs.Construct, nlb awselbv2.NetworkLoadBalancer, vpc awsec2.IVpc) awselbv2.NetworkTargetGroup {
+	targets := awselbv2.NewNetworkTargetGroup(scope, jsii.String("targetgroup-6443"), &awselbv2.NetworkTargetGroupProps{
+		Port: jsii.Number(6443),
+		HealthCheck: &awselbv2.HealthCheck{
+			Enabled:  jsii.Bool(true),
+			Port:     jsii.String("6443"),
+			Protocol: awselbv2.Protocol_TCP,
+		},
+		TargetType: awselbv2.TargetType_INSTANCE,
+		Vpc:        vpc,
+	})
+
+	nlb.AddListener(jsii.String("talos-cp-listener-6443"), &awselbv2.BaseNetworkListenerProps{
+		Port:                jsii.Number(6443),
+		Protocol:            awselbv2.Protocol_TCP,
+		DefaultTargetGroups: &[]awselbv2.INetworkTargetGroup{targets},
+	})
+
+	return targets
+}
+
+// setNLBSecurityGroups attaches security groups to an NLB, which the L2 construct doesn't support.
+// Targets can then reference the groups in their rules. Adding groups to an existing NLB replaces it.
+func setNLBSecurityGroups(nlb awselbv2.NetworkLoadBalancer, sgs ...awsec2.ISecurityGroup) {
+	var ids []*string
+	for _, sg := range sgs {
+		ids = append(ids, sg.SecurityGroupId())
+	}
+	var cfn awselbv2.CfnLoadBalancer
+	defaultChild(nlb, &cfn)
+	cfn.SetSecurityGroups(&ids)
+}
+
+// setNLBDualStack makes an NLB listen on IPv4 and IPv6. Its subnets need IPv6 CIDRs.
+func setNLBDualStack(nlb awselbv2.NetworkLoadBalancer) {
+	var cfn awselbv2.CfnLoadBalancer
+	defaultChild(nlb, &cfn)
+	cfn.SetIpAddressType(jsii.String("dualstack"))
+}
@@ -0,0 +1,124 @@
+package taloscdk
+
+import (
+	"strings"
+
+	"github.com/aws/aws-cdk-go/awscdk"
+	"github.com/aws/aws-cdk-go/awscdk/awsautoscaling"
+	"github.com/aws/aws-cdk-go/awscdk/awsec2"
+	"github.com/aws/aws-cdk-go/awscdk/awsevents"
+	"github.com/aws/aws-cdk-go/awscdk/awseventstargets"
+	"github.com/aws/aws-cdk-go/awscdk/awsiam"
+	"github.com/aws/aws-cdk-go/awscdk/awssecretsmanager"
+	"github.com/aws/jsii-runtime-go"
+)
+
+// ReadinessCheck determines when a node counts as ready for its ASG's creation signal
+type ReadinessCheck string
+
+const (
+	// ReadinessCheckTalos waits for the node's Talos API to answer and its kubelet service to be healthy
+	ReadinessCheckTalos ReadinessCheck = "talos"
+
+	// ReadinessCheckKubernetes waits for the node to be Ready in Kubernetes. This needs a bootstrapped
+	// control plane and a working CNI, so it can't be used on a control plane with Bootstrap enabled
+	// (the bootstrap only starts once the control plane ASGs have been created).
+	ReadinessCheckKubernetes ReadinessCheck = "kubernetes"
+)
+
+type readinessProps struct {
+	Vpc         awsec2.IVpc
+	Subnets     *awsec2.SubnetSelection
+	NodeSG      awsec2.SecurityGroup
+	Talosconfig awssecretsmanager.ISecret
+	Check       ReadinessCheck
+}
+
+// readinessSignals returns the creation policy of an ASG that waits for all of its nodes to be ready
+func readinessSignals(timeout awscdk.Duration) awsautoscaling.Signals {
+	if timeout == nil {
+		timeout = awscdk.Duration_Minutes(jsii.Number(30))
+	}
+
+	return awsautoscaling.Signals_WaitForAll(&awsautoscaling.SignalsOptions{Timeout: timeout})
+}
+
+// addReadinessSignals polls the nodes of asgs every minute while CloudFormation creates or replaces them, and
+// sends a signal for each ready node. The ASGs must have been created with readinessSignals().
+// The function only knows the ASGs by logical ID, it has to exist before the ASGs finish creating.
+// Once no ASG waits for signals and the stack is done, the function disables its schedule. The schedule
+// depends on the launch configurations and the ASGs on the schedule, so an update that changes the nodes
+// enables it again before the ASGs start waiting.
+func addReadinessSignals(scope awscdk.Construct, asgs []awsautoscaling.AutoScalingGroup, props *readinessProps) {
+	if props.Talosconfig == nil {
+		panic("WaitForReady requires a TalosconfigSecret")
+	}
+
+	if props.Check == "" {
+		props.Check = ReadinessCheckTalos
+	}
+
+	var cfns []awsautoscaling.CfnAutoScalingGroup
+	var ids, launchConfigs []string
+	for _, asg := range asgs {
+		var cfn awsautoscaling.CfnAutoScalingGroup
+		defaultChild(asg, &cfn)
+		cfns = append(cfns, cfn)
+		ids = append(ids, *cfn.LogicalId())
+		launchConfigs = append(launchConfigs, *cfn.LaunchConfigurationName())
+	}
+
+	stack := awscdk.Stack_Of(scope)
+
+	fn := newTalosAPIFunction(scope, jsii.String("ReadinessFunction"), "readiness", props.Vpc, props.Subnets, props.NodeSG, props.Talosconfig, map[string]*string{
+		"STACK_NAME":      stack.StackName(),
+		"ASG_LOGICAL_IDS": jsii.String(strings.Join(ids, ",")),
+		"READINESS_CHECK": jsii.String(string(props.Check)),
+	}, nil)
+
+	fn.AddToRolePolicy(awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
+		Effect: awsiam.Effect_ALLOW,
+		Actions: jsii.Strings(
+			"cloudformation:DescribeStackResource",
+			"cloudformation:DescribeStacks",
+			"cloudformation:SignalResource",
+		),
+		Resources: &[]*string{stack.StackId()},
+	}))
+
+	fn.AddToRolePolicy(awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
+		Effect: awsiam.Effect_ALLOW,
+		Actions: jsii.Strings(
+			"autoscaling:DescribeAutoScalingGroups",
+			"ec2:DescribeInstances",
+		),
+		Resources: jsii.Strings("*"),
+	}))
+
+	// Updating the rule enables it again, which the launch configurations in its description make sure of
+	rule := awsevents.NewRule(scope, jsii.String("ReadinessSchedule"), &awsevents.RuleProps{
+		Description: jsii.String("Signals CloudFormation once Talos nodes are ready, for " + strings.Join(launchConfigs, ", ")),
+		Schedule:    awsevents.Schedule_Rate(awscdk.Duration_Minutes(jsii.Number(1))),
+		Targets:     &[]awsevents.IRuleTarget{awseventstargets.NewLambdaFunction(fn, nil)},
+	})
+	for _, cfn := range cfns {
+		cfn.Node().AddDependency(rule)
+	}
+
+	// Not part of the function's default policy, which the function depends on: the rule targets the function
+	awsiam.NewPolicy(scope, jsii.String("ReadinessSchedulePolicy"), &awsiam.PolicyProps{
+		Roles: &[]awsiam.IRole{fn.Role()},
+		Statements: &[]awsiam.PolicyStatement{
+			awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
+				Effect:    awsiam.Effect_ALLOW,
+				Actions:   jsii.Strings("events:ListRuleNamesByTarget"),
+				Resources: jsii.Strings("*"),
+			}),
+			awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
+				Effect:    awsiam.Effect_ALLOW,
+				Actions:   jsii.Strings("events:DisableRule"),
+				Resources: &[]*string{rule.RuleArn()},
+			}),
+		},
+	})
+}
@@ -1,6 +1,7 @@
 package taloscdk
 
 import (
+	"github.com/aws/aws-cdk-go/awscdk"
 	"github.com/aws/aws-cdk-go/awscdk/awsec2"
 	"github.com/aws/constructs-go/constructs/v3"
 	"github.com/aws/jsii-runtime-go"
@@ -10,14 +11,88 @@ type SecurityGroupProps struct {
 	// Required.
 	Vpc awsec2.IVpc
 
-	// AllowTrafficFrom is the peer to allow ingress to the Kubernetes and Talos APIs.
-	// Default: awsec2.Peer_AnyIpv4
+	// AllowTrafficFrom is a peer to allow ingress to both the Kubernetes and Talos APIs.
+	// Deprecated: use KubernetesAPIPeers and TalosAPIPeers. If set, it's added to both.
+	// Default: nil
 	AllowTrafficFrom awsec2.IPeer
+
+	// KubernetesAPIPeers may reach the Kubernetes API (6443). Peers can be CIDRs (awsec2.Peer_Ipv4()),
+	// managed prefix lists (awsec2.Peer_PrefixList()) or security groups.
+	// Through an internet-facing NLB, nodes reach the API from their public IPs or NAT gateway EIPs rather
+	// than from the group, so include those when replacing the default.
+	// Default: awsec2.Peer_AnyIpv4 (unless AllowTrafficFrom is set)
+	KubernetesAPIPeers []awsec2.IPeer
+
+	// TalosAPIPeers may reach the Talos API (50000-50001), e.g. the CIDR of a VPN or bastion security group.
+	// Default: nil (only nodes in the group and Lambda-backed features)
+	TalosAPIPeers []awsec2.IPeer
+
+	// PublicTalosAPI allows the Talos API from anywhere (0.0.0.0/0) in addition to TalosAPIPeers.
+	// The Talos API uses mutual TLS, but exposing it publicly is not recommended.
+	// Default: jsii.Bool(false)
+	PublicTalosAPI *bool
+
+	// DualStack adds IPv6 rules (::/0) next to the IPv4 defaults of KubernetesAPIPeers and PublicTalosAPI,
+	// and to the outbound rules unless RestrictedEgress is set
+	// Default: jsii.Bool(false)
+	DualStack *bool
+
+	// RestrictedEgress replaces allow all outbound with explicit rules for what Talos needs, and all traffic
+	// within the group. Patch the node configs with RestrictedEgressConfigPatch() to use the allowed time servers.
+	// Default: nil (all outbound traffic is allowed)
+	RestrictedEgress *EgressProps
+
+	// KubeSpan opens the KubeSpan WireGuard port (UDP 51820) within the group, to KubeSpanProps.Peers and
+	// between the group and KubeSpanProps.NodeSecurityGroups.
+	// Patch the node configs with KubeSpanConfigPatch().
+	// Default: nil
+	KubeSpan *KubeSpanProps
+
+	// Description of the security group
+	// Default: Talos Security Group
+	Description *string
+
+	// SecurityGroupName of the security group
+	// Default: nil (CloudFormation generates the name)
+	SecurityGroupName *string
+
+	// Tags added to the security group
+	// Default: nil
+	Tags map[string]string
 }
 
-// NewSecurityGroup returns a security group that enables ingress to 6443, 50000, 50001,
-// as well as all internal traffic within the security group.
+// apiPeers returns the peers allowed to reach the Kubernetes API and the Talos API
+func apiPeers(allowTrafficFrom awsec2.IPeer, kubernetesAPIPeers []awsec2.IPeer, talosAPIPeers []awsec2.IPeer, publicTalosAPI *bool, dualStack *bool) ([]awsec2.IPeer, []awsec2.IPeer) {
+	anyPeers := []awsec2.IPeer{awsec2.Peer_AnyIpv4()}
+	if dualStack != nil && *dualStack {
+		anyPeers = append(anyPeers, awsec2.Peer_AnyIpv6())
+	}
+
+	kubernetes := append([]awsec2.IPeer{}, kubernetesAPIPeers...)
+	talos := append([]awsec2.IPeer{}, talosAPIPeers...)
+
+	if allowTrafficFrom != nil {
+		kubernetes = append(kubernetes, allowTrafficFrom)
+		talos = append(talos, allowTrafficFrom)
+	}
+
+	if kubernetesAPIPeers == nil && allowTrafficFrom == nil {
+		kubernetes = append(kubernetes, anyPeers...)
+	}
+
+	if publicTalosAPI != nil && *publicTalosAPI {
+		talos = append(talos, anyPeers...)
+	}
+
+	return kubernetes, talos
+}
+
+// NewSecurityGroup returns a security group that enables ingress to 6443 from KubernetesAPIPeers, to 50000-50001
+// from TalosAPIPeers, as well as all internal traffic within the security group.
+// Rules for more peers can be added later with AllowKubernetesAPIAccess(), AllowTalosAPIAccess() and AddClusterPeer().
 // Requires a Vpc in the *SecurityGroupProps
+// The group used to be created with the id "TalosSG" regardless of id. Groups created before that changed are
+// replaced (along with the instances using them) unless id is "TalosSG".
 func NewSecurityGroup(scope constructs.Construct, id *string, props *SecurityGroupProps) awsec2.SecurityGroup {
 	if props == nil {
 		props = &SecurityGroupProps{}
@@ -27,19 +102,55 @@ func NewSecurityGroup(scope constructs.Construct, id *string, props *SecurityGro
 		panic("NewSecurityGroup() requires a Vpc in SecurityGroupProps")
 	}
 
-	// Default to allow from all
-	if props.AllowTrafficFrom == nil {
-		props.AllowTrafficFrom = awsec2.Peer_AnyIpv4()
+	if props.Description == nil {
+		props.Description = jsii.String("Talos Security Group")
 	}
 
-	sg := awsec2.NewSecurityGroup(scope, jsii.String("TalosSG"), &awsec2.SecurityGroupProps{
-		Vpc:              props.Vpc,
-		AllowAllOutbound: jsii.Bool(true),
-		Description:      jsii.String("Talos Security Group"),
+	sg := awsec2.NewSecurityGroup(scope, id, &awsec2.SecurityGroupProps{
+		Vpc:               props.Vpc,
+		AllowAllOutbound:  jsii.Bool(props.RestrictedEgress == nil),
+		Description:       props.Description,
+		SecurityGroupName: props.SecurityGroupName,
 	})
 
+	for key, value := range props.Tags {
+		awscdk.Tags_Of(sg).Add(jsii.String(key), jsii.String(value), nil)
+	}
+
+	kubernetesAPIPeers, talosAPIPeers := apiPeers(props.AllowTrafficFrom, props.KubernetesAPIPeers, props.TalosAPIPeers, props.PublicTalosAPI, props.DualStack)
+
+	for _, peer := range kubernetesAPIPeers {
+		AllowKubernetesAPIAccess(sg, peer)
+	}
+
+	for _, peer := range talosAPIPeers {
+		AllowTalosAPIAccess(sg, peer)
+	}
+
 	sg.AddIngressRule(
-		props.AllowTrafficFrom,
+		sg,
+		awsec2.Port_AllTraffic(),
+		jsii.String("Allow all internal traffic between nodes"),
+		jsii.Bool(false),
+	)
+
+	if props.RestrictedEgress != nil {
+		addEgressRules(sg, props.Vpc, props.RestrictedEgress, sg)
+	} else if props.DualStack != nil && *props.DualStack {
+		allowAllIpv6Outbound(sg)
+	}
+
+	if props.KubeSpan != nil {
+		addKubeSpanRules(sg, props.KubeSpan, sg)
+	}
+
+	return sg
+}
+
+// AllowKubernetesAPIAccess allows peer to reach the Kubernetes API (6443) of the nodes in sg
+func AllowKubernetesAPIAccess(sg awsec2.ISecurityGroup, peer awsec2.IPeer) {
+	sg.AddIngressRule(
+		peer,
 		awsec2.NewPort(&awsec2.PortProps{
 			Protocol:             awsec2.Protocol_TCP,
 			FromPort:             jsii.Number(6443),
@@ -48,9 +159,12 @@ func NewSecurityGroup(scope constructs.Construct, id *string, props *SecurityGro
 		jsii.String("Kubernetes API"),
 		jsii.Bool(false),
 	)
+}
 
+// AllowTalosAPIAccess allows peer to reach the Talos API (50000-50001) of the nodes in sg
+func AllowTalosAPIAccess(sg awsec2.ISecurityGroup, peer awsec2.IPeer) {
 	sg.AddIngressRule(
-		props.AllowTrafficFrom,
+		peer,
 		awsec2.NewPort(&awsec2.PortProps{
 			Protocol:             awsec2.Protocol_TCP,
 			FromPort:             jsii.Number(50000),
@@ -59,13 +173,19 @@ func NewSecurityGroup(scope constructs.Construct, id *string, props *SecurityGro
 		jsii.String("Talos API"),
 		jsii.Bool(false),
 	)
+}
 
-	sg.AddIngressRule(
-		sg,
-		awsec2.Port_AllTraffic(),
-		jsii.String("Allow all internal traffic between nodes"),
-		jsii.Bool(false),
-	)
+// AddClusterPeer allows all traffic between the nodes in sg and the nodes in peer, e.g. a separate
+// worker security group created with NewSecurityGroup(). Groups with RestrictedEgress get egress rules as well.
+func AddClusterPeer(sg awsec2.ISecurityGroup, peer awsec2.ISecurityGroup) {
+	sg.AddIngressRule(peer, awsec2.Port_AllTraffic(), jsii.String("Allow all traffic from cluster peer"), jsii.Bool(false))
+	peer.AddIngressRule(sg, awsec2.Port_AllTraffic(), jsii.String("Allow all traffic from cluster peer"), jsii.Bool(false))
 
-	return sg
+	if !*sg.AllowAllOutbound() {
+		sg.AddEgressRule(peer, awsec2.Port_AllTraffic(), jsii.String("Allow all traffic to cluster peer"), jsii.Bool(false))
+	}
+
+	if !*peer.AllowAllOutbound() {
+		peer.AddEgressRule(sg, awsec2.Port_AllTraffic(), jsii.String("Allow all traffic to cluster peer"), jsii.Bool(false))
+	}
 }
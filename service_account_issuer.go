@@ -0,0 +1,283 @@
+package taloscdk
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+
+	"github.com/aws/aws-cdk-go/awscdk"
+	"github.com/aws/aws-cdk-go/awscdk/awsiam"
+	"github.com/aws/aws-cdk-go/awscdk/awss3"
+	"github.com/aws/aws-cdk-go/awscdk/customresources"
+	"github.com/aws/constructs-go/constructs/v3"
+	"github.com/aws/jsii-runtime-go"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	discoveryDocumentKey = ".well-known/openid-configuration"
+	jwksKey              = "openid/v1/jwks"
+)
+
+type ServiceAccountIssuerProps struct {
+	// TalosNodeConfig is the control plane config holding the service account signing key (cluster.serviceAccount.key).
+	// The JWKS is derived from it, so the issuer has to be recreated if the key changes.
+	// TalosNodeConfig is required
+	TalosNodeConfig *string
+
+	// Audiences accepted by the IAM OIDC provider
+	// Default: sts.amazonaws.com
+	Audiences []string
+}
+
+type ServiceAccountIssuer struct {
+	constructs.Construct
+
+	// Bucket hosting the public discovery document and JWKS
+	Bucket awss3.Bucket
+
+	// IssuerURL is the https URL of the bucket, used as the service-account-issuer of the API server
+	IssuerURL *string
+
+	Provider awsiam.OpenIdConnectProvider
+
+	// ConfigPatch sets the API server's service-account-issuer and service-account-jwks-uri.
+	// Apply it to the control plane config with taloscdk.PatchConfig before creating the control plane.
+	ConfigPatch map[string]interface{}
+}
+
+// NewServiceAccountIssuer creates an OIDC issuer for Kubernetes service account tokens, hosted in S3, and an
+// IAM OIDC provider trusting it. Pods can then assume IAM roles created with NewServiceAccountRole (IRSA)
+// instead of using the node role, by mounting a projected service account token with the sts.amazonaws.com
+// audience and setting AWS_ROLE_ARN and AWS_WEB_IDENTITY_TOKEN_FILE.
+// Required ServiceAccountIssuerProps: TalosNodeConfig
+func NewServiceAccountIssuer(scope constructs.Construct, id *string, props *ServiceAccountIssuerProps) ServiceAccountIssuer {
+	construct := awscdk.NewConstruct(scope, jsii.String(*id))
+
+	if props.TalosNodeConfig == nil {
+		panic("TalosNodeConfig cannot be nil. taloscdk.LoadConfig() can be used to load the needed file.")
+	}
+
+	if props.Audiences == nil {
+		props.Audiences = []string{"sts.amazonaws.com"}
+	}
+
+	jwks, alg := serviceAccountJWKS(props.TalosNodeConfig)
+
+	// Only the two documents are public
+	bucket := awss3.NewBucket(construct, jsii.String("Bucket"), &awss3.BucketProps{
+		Encryption: awss3.BucketEncryption_S3_MANAGED,
+		BlockPublicAccess: awss3.NewBlockPublicAccess(&awss3.BlockPublicAccessOptions{
+			BlockPublicAcls:       jsii.Bool(true),
+			IgnorePublicAcls:      jsii.Bool(true),
+			BlockPublicPolicy:     jsii.Bool(false),
+			RestrictPublicBuckets: jsii.Bool(false),
+		}),
+	})
+
+	bucket.AddToResourcePolicy(awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
+		Effect:     awsiam.Effect_ALLOW,
+		Actions:    jsii.Strings("s3:GetObject"),
+		Principals: &[]awsiam.IPrincipal{awsiam.NewAnyPrincipal()},
+		Resources:  &[]*string{bucket.ArnForObjects(jsii.String(discoveryDocumentKey)), bucket.ArnForObjects(jsii.String(jwksKey))},
+	}))
+
+	issuerURL := jsii.String(fmt.Sprintf("https://%s", *bucket.BucketRegionalDomainName()))
+	jwksURI := jsii.String(fmt.Sprintf("%s/%s", *issuerURL, jwksKey))
+
+	discovery, err := json.Marshal(map[string]interface{}{
+		"issuer":                                issuerURL,
+		"jwks_uri":                              jwksURI,
+		"authorization_endpoint":                "urn:kubernetes:programmatic_authorization",
+		"response_types_supported":              []string{"id_token"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{alg},
+		"claims_supported":                      []string{"sub", "iss"},
+	})
+	if err != nil {
+		panic(fmt.Sprintf("Could not encode OIDC discovery document: %v", err))
+	}
+
+	upload := customresources.NewAwsCustomResource(construct, jsii.String("Documents"), &customresources.AwsCustomResourceProps{
+		OnCreate: putObjectCall(bucket, discoveryDocumentKey, string(discovery)),
+		OnUpdate: putObjectCall(bucket, discoveryDocumentKey, string(discovery)),
+		OnDelete: deleteObjectCall(bucket, discoveryDocumentKey),
+		Policy: customresources.AwsCustomResourcePolicy_FromStatements(&[]awsiam.PolicyStatement{
+			awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
+				Effect:    awsiam.Effect_ALLOW,
+				Actions:   jsii.Strings("s3:PutObject", "s3:DeleteObject"),
+				Resources: &[]*string{bucket.ArnForObjects(jsii.String("*"))},
+			}),
+		}),
+	})
+
+	uploadJWKS := customresources.NewAwsCustomResource(construct, jsii.String("JWKS"), &customresources.AwsCustomResourceProps{
+		OnCreate: putObjectCall(bucket, jwksKey, jwks),
+		OnUpdate: putObjectCall(bucket, jwksKey, jwks),
+		OnDelete: deleteObjectCall(bucket, jwksKey),
+		Policy: customresources.AwsCustomResourcePolicy_FromStatements(&[]awsiam.PolicyStatement{
+			awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
+				Effect:    awsiam.Effect_ALLOW,
+				Actions:   jsii.Strings("s3:PutObject", "s3:DeleteObject"),
+				Resources: &[]*string{bucket.ArnForObjects(jsii.String("*"))},
+			}),
+		}),
+	})
+
+	provider := awsiam.NewOpenIdConnectProvider(construct, jsii.String("Provider"), &awsiam.OpenIdConnectProviderProps{
+		Url:       issuerURL,
+		ClientIds: jsii.Strings(props.Audiences...),
+	})
+	provider.Node().AddDependency(upload, uploadJWKS)
+
+	patch := map[string]interface{}{
+		"cluster": map[string]interface{}{
+			"apiServer": map[string]interface{}{
+				"extraArgs": map[string]interface{}{
+					"service-account-issuer":   *issuerURL,
+					"service-account-jwks-uri": *jwksURI,
+				},
+			},
+		},
+	}
+
+	return ServiceAccountIssuer{Construct: construct, Bucket: bucket, IssuerURL: issuerURL, Provider: provider, ConfigPatch: patch}
+}
+
+// NewServiceAccountRole creates a role that can only be assumed by the service account serviceAccount
+// in namespace, with a token issued for the sts.amazonaws.com audience.
+func (i *ServiceAccountIssuer) NewServiceAccountRole(scope constructs.Construct, id *string, namespace string, serviceAccount string) awsiam.Role {
+	// The condition keys contain the issuer, a token, so they're resolved by CloudFormation
+	conditions := awscdk.NewCfnJson(scope, jsii.String(*id+"Conditions"), &awscdk.CfnJsonProps{
+		Value: map[string]interface{}{
+			fmt.Sprintf("%s:sub", *i.Provider.OpenIdConnectProviderIssuer()): fmt.Sprintf("system:serviceaccount:%s:%s", namespace, serviceAccount),
+			fmt.Sprintf("%s:aud", *i.Provider.OpenIdConnectProviderIssuer()): "sts.amazonaws.com",
+		},
+	})
+
+	return awsiam.NewRole(scope, id, &awsiam.RoleProps{
+		Description: jsii.String(fmt.Sprintf("Service account %s/%s", namespace, serviceAccount)),
+		AssumedBy: awsiam.NewOpenIdConnectPrincipal(i.Provider, &map[string]interface{}{
+			"StringEquals": conditions,
+		}),
+	})
+}
+
+func putObjectCall(bucket awss3.IBucket, key string, body string) *customresources.AwsSdkCall {
+	return &customresources.AwsSdkCall{
+		Service: jsii.String("S3"),
+		Action:  jsii.String("putObject"),
+		Parameters: map[string]interface{}{
+			"Bucket":      bucket.BucketName(),
+			"Key":         key,
+			"Body":        body,
+			"ContentType": "application/json",
+		},
+		PhysicalResourceId: customresources.PhysicalResourceId_Of(jsii.String(key)),
+	}
+}
+
+func deleteObjectCall(bucket awss3.IBucket, key string) *customresources.AwsSdkCall {
+	return &customresources.AwsSdkCall{
+		Service: jsii.String("S3"),
+		Action:  jsii.String("deleteObject"),
+		Parameters: map[string]interface{}{
+			"Bucket": bucket.BucketName(),
+			"Key":    key,
+		},
+	}
+}
+
+// serviceAccountJWKS returns the JWKS of the service account signing key in config and its JWS algorithm
+func serviceAccountJWKS(config *string) (string, string) {
+	var machineConfig struct {
+		Cluster struct {
+			ServiceAccount struct {
+				Key string `yaml:"key"`
+			} `yaml:"serviceAccount"`
+		} `yaml:"cluster"`
+	}
+	if err := yaml.Unmarshal([]byte(*config), &machineConfig); err != nil {
+		panic(fmt.Sprintf("Could not parse Talos config: %v", err))
+	}
+
+	if machineConfig.Cluster.ServiceAccount.Key == "" {
+		panic("The Talos config has no cluster.serviceAccount.key, use a control plane config")
+	}
+
+	pemBytes, err := base64.StdEncoding.DecodeString(machineConfig.Cluster.ServiceAccount.Key)
+	if err != nil {
+		panic(fmt.Sprintf("Could not decode cluster.serviceAccount.key: %v", err))
+	}
+
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		panic("cluster.serviceAccount.key is not PEM encoded")
+	}
+
+	var key crypto.Signer
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		var parsed interface{}
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		if signer, ok := parsed.(crypto.Signer); ok {
+			key = signer
+		}
+	}
+	if err != nil || key == nil {
+		panic(fmt.Sprintf("Could not parse cluster.serviceAccount.key: %v", err))
+	}
+
+	// Same key ID as the API server puts into the tokens it signs
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		panic(fmt.Sprintf("Could not encode service account public key: %v", err))
+	}
+	sum := sha256.Sum256(der)
+	kid := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	var jwk map[string]string
+	var alg string
+	switch public := key.Public().(type) {
+	case *ecdsa.PublicKey:
+		size := (public.Curve.Params().BitSize + 7) / 8
+		alg = map[int]string{256: "ES256", 384: "ES384", 521: "ES512"}[public.Curve.Params().BitSize]
+		jwk = map[string]string{
+			"kty": "EC",
+			"crv": public.Curve.Params().Name,
+			"x":   base64.RawURLEncoding.EncodeToString(public.X.FillBytes(make([]byte, size))),
+			"y":   base64.RawURLEncoding.EncodeToString(public.Y.FillBytes(make([]byte, size))),
+		}
+	case *rsa.PublicKey:
+		alg = "RS256"
+		jwk = map[string]string{
+			"kty": "RSA",
+			"n":   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+		}
+	default:
+		panic(fmt.Sprintf("Unsupported service account key type %T", public))
+	}
+
+	jwk["kid"] = kid
+	jwk["use"] = "sig"
+	jwk["alg"] = alg
+
+	jwks, err := json.Marshal(map[string]interface{}{"keys": []interface{}{jwk}})
+	if err != nil {
+		panic(fmt.Sprintf("Could not encode JWKS: %v", err))
+	}
+
+	return string(jwks), alg
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/aws/aws-cdk-go/awscdk"
 	"github.com/aws/aws-cdk-go/awscdk/awsec2"
 	"github.com/aws/aws-cdk-go/awscdk/awsiam"
+	"github.com/aws/aws-cdk-go/awscdk/awssecretsmanager"
 	"github.com/aws/constructs-go/constructs/v3"
 	"github.com/aws/jsii-runtime-go"
 )
@@ -66,7 +67,8 @@ type SingleNodeProps struct {
 	// SecurityGroup for the instance.
 	// To create a security group to use with multiple images, you can use:
 	// taloscdk.NewSecutiyGroup()
-	// Default: Generates a new security group, opening ports: 6443, 50000, 50001 to the any peer
+	// Default: Generates a new security group, opening port 6443 to any peer. The Talos API (50000, 50001)
+	// is not opened, create the group with SecurityGroupProps.TalosAPIPeers to use talosctl from outside of it
 	SecurityGroup awsec2.SecurityGroup
 
 	// Vpc selects the AWS VPC to deploy your instance into.
@@ -86,7 +88,42 @@ type SingleNodeProps struct {
 	// If planning to create AWS load balancers, it's best to use
 	// taloscdk.NewControlPlaneIAMRole() or taloscdk.NewWorkerIAMRole()
 	// Default: NewControlPlaneIAMRole()
-	IAMRole awsiam.Role
+	IAMRole awsiam.IRole
+
+	// IAMRoleProps configure the default IAMRole (permissions boundary, path, managed policies, name prefix).
+	// Ignored if IAMRole is set.
+	// Default: nil
+	IAMRoleProps *IAMRoleProps
+
+	// TalosconfigSecret is a Secrets Manager secret containing a talosconfig for the cluster,
+	// e.g. from NewClusterSecrets(). Required by Bootstrap.
+	// Default: nil
+	TalosconfigSecret awssecretsmanager.ISecret
+
+	// TalosAPIFunctionSubnets are the subnets for Lambda functions that call the Talos API.
+	// They need a route to AWS APIs, through a NAT gateway or VPC endpoints. The default VPC has no
+	// private subnets, so set this when using Bootstrap there.
+	// Default: &awsec2.SubnetSelection{SubnetType: awsec2.SubnetType_PRIVATE}
+	TalosAPIFunctionSubnets *awsec2.SubnetSelection
+
+	// Bootstrap adds a custom resource that waits for the node, runs the Talos bootstrap once and
+	// waits for etcd to be healthy. Requires TalosconfigSecret.
+	// Default: jsii.Bool(false)
+	Bootstrap *bool
+
+	// BootstrapTimeout is how long to wait for the node to boot and etcd to become healthy.
+	// Default: awscdk.Duration_Minutes(jsii.Number(30))
+	BootstrapTimeout awscdk.Duration
+
+	// KubeconfigSecret receives the admin kubeconfig once Bootstrap is done, e.g. from NewClusterSecrets().
+	// Requires Bootstrap.
+	// Default: nil
+	KubeconfigSecret awssecretsmanager.ISecret
+
+	// DualStack adds IPv6 pod and service CIDRs to TalosNodeConfig, gives the instance an IPv6 address and
+	// opens the default security group to IPv6. SubnetSelection needs an IPv6 CIDR.
+	// Default: nil (IPv4 only)
+	DualStack *DualStackProps
 }
 
 type SingleNode struct {
@@ -99,6 +136,13 @@ type SingleNode struct {
 
 	// EIP (if allocated/assigned)
 	EIP awsec2.CfnEIP
+
+	// Bootstrap custom resource (if enabled)
+	Bootstrap awscdk.CustomResource
+
+	// TalosconfigSecret and KubeconfigSecret (if given), their ARNs are also stack outputs
+	TalosconfigSecret awssecretsmanager.ISecret
+	KubeconfigSecret  awssecretsmanager.ISecret
 }
 
 func (s *SingleNode) GetEIPAddress() *string {
@@ -128,8 +172,9 @@ func NewSingleNode(scope constructs.Construct, id *string, props *SingleNodeProp
 	}
 
 	if props.SecurityGroup == nil {
-		props.SecurityGroup = NewSecurityGroup(construct, jsii.String("SG"), &SecurityGroupProps{
-			Vpc: props.Vpc,
+		props.SecurityGroup = NewSecurityGroup(construct, jsii.String("TalosSG"), &SecurityGroupProps{
+			Vpc:       props.Vpc,
+			DualStack: jsii.Bool(props.DualStack != nil),
 		})
 	}
 
@@ -168,23 +213,15 @@ func NewSingleNode(scope constructs.Construct, id *string, props *SingleNodeProp
 	}
 
 	if props.IAMRole == nil {
-		props.IAMRole = NewControlPlaneIAMRole(construct, jsii.String("Role"))
+		props.IAMRole = NewControlPlaneIAMRole(construct, jsii.String("Role"), props.IAMRoleProps)
 	}
 
-	var image awsec2.IMachineImage
-
-	if props.MachineImageAMI != nil {
-		image = awsec2.NewGenericLinuxImage(props.MachineImageAMI, &awsec2.GenericLinuxImageProps{
-			UserData: awsec2.UserData_Custom(props.TalosNodeConfig),
-		})
-	} else {
-		image = awsec2.NewLookupMachineImage(&awsec2.LookupMachineImageProps{
-			Name:     props.MachineImageName,
-			Owners:   jsii.Strings("540036508848"),
-			UserData: awsec2.UserData_Custom(props.TalosNodeConfig),
-		})
+	if props.DualStack != nil {
+		props.TalosNodeConfig = PatchConfig(props.TalosNodeConfig, DualStackConfigPatch(props.DualStack))
 	}
 
+	image := newMachineImage(props.MachineImageAMI, props.MachineImageName, props.TalosNodeConfig)
+
 	instance := awsec2.NewInstance(construct, jsii.String("Instance"), &awsec2.InstanceProps{
 		InstanceName:  props.NodeName,
 		InstanceType:  props.InstanceType,
@@ -195,12 +232,33 @@ func NewSingleNode(scope constructs.Construct, id *string, props *SingleNodeProp
 		Role:          props.IAMRole,
 	})
 
+	if props.DualStack != nil {
+		assignIpv6Address(instance)
+	}
+
 	if *props.CreateEIP {
 		awsec2.NewCfnEIPAssociation(construct, jsii.String("EIPAssoc"), &awsec2.CfnEIPAssociationProps{InstanceId: instance.InstanceId(), Eip: eip.Ref()})
 	}
 
+	var bootstrap awscdk.CustomResource
+	if props.Bootstrap != nil && *props.Bootstrap {
+		bootstrap = newBootstrap(construct, &bootstrapProps{
+			Vpc:         props.Vpc,
+			Subnets:     props.TalosAPIFunctionSubnets,
+			NodeSG:      props.SecurityGroup,
+			Talosconfig: props.TalosconfigSecret,
+			Timeout:     props.BootstrapTimeout,
+			Endpoints:   []*string{instance.InstancePrivateIp()},
+			Kubeconfig:  props.KubeconfigSecret,
+		})
+	} else if props.KubeconfigSecret != nil {
+		panic("KubeconfigSecret requires Bootstrap")
+	}
+
+	addSecretOutputs(construct, props.TalosconfigSecret, props.KubeconfigSecret)
+
 	awscdk.Tags_Of(construct).Add(jsii.String(fmt.Sprintf("kubernetes.io/cluster/%s", *props.ClusterName)), jsii.String("owned"), nil)
 	TagSubnets(props.Vpc)
 
-	return SingleNode{Construct: construct, SecurityGroup: props.SecurityGroup, Vpc: props.Vpc, EIP: eip}
+	return SingleNode{Construct: construct, SecurityGroup: props.SecurityGroup, Vpc: props.Vpc, EIP: eip, Bootstrap: bootstrap, TalosconfigSecret: props.TalosconfigSecret, KubeconfigSecret: props.KubeconfigSecret}
 }
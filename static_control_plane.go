@@ -0,0 +1,319 @@
+package taloscdk
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-cdk-go/awscdk"
+	"github.com/aws/aws-cdk-go/awscdk/awsec2"
+	awselbv2 "github.com/aws/aws-cdk-go/awscdk/awselasticloadbalancingv2"
+	awselbv2targets "github.com/aws/aws-cdk-go/awscdk/awselasticloadbalancingv2targets"
+	"github.com/aws/aws-cdk-go/awscdk/awsiam"
+	"github.com/aws/aws-cdk-go/awscdk/awss3"
+	"github.com/aws/constructs-go/constructs/v3"
+	"github.com/aws/jsii-runtime-go"
+)
+
+type StaticControlPlaneProps struct {
+	// ClusterName is used for tagging all resources with kubernetes.io/cluster/<name>=owned
+	// Default: talos
+	ClusterName *string
+
+	// Nodes describes each control plane instance. Nodes are spread across the AZs in SubnetSelection
+	// in order, unless a node sets its own Subnet.
+	// Default: 3 nodes named <ClusterName>-cp-1, <ClusterName>-cp-2 and <ClusterName>-cp-3
+	Nodes []StaticNodeProps
+
+	// MachineImageName is used for searching AMI by name and supports * wildcard.
+	// Be sure to select an arch that matches your instance type.
+	// It's typically easiest to use a wildcard for the region so that it works cross-region.
+	// Format: talos-<Version>-<AWSRegion>-<arch>
+	// Default: talos-v0.11.2-*-amd64
+	MachineImageName *string
+
+	// MachineImageAMI is used to get the image from an AMI.
+	// Talos AMIs can be found in the docs: https://www.talos.dev/docs/v0.11/cloud-platforms/aws/ (sub v0.11 for current version)
+	// Example: {"us-east-1": jsii.String("ami-0fdb2f5cb915076a3")}  (us-east-1 amd64 v0.11 image)
+	// Defaults to using MachineImageName
+	MachineImageAMI *map[string]*string
+
+	// TalosNodeConfig is a *string of the controlplane.yaml you've generated with
+	// `talosctl gen config <clusterName> <endpoint>`. It is shared by all nodes, with each node's
+	// hostname and ConfigPatch merged in.
+	// TalosNodeConfig is required
+	TalosNodeConfig *string
+
+	// TransformConfig sets whether or not to change the endpoint in our TalosNodeConfig to
+	// the OverwriteValue
+	// Default: jsii.Bool(true)
+	TransformConfig *bool
+
+	// EndpointToOverwrite  is the <endpoint> you used when running `talosctl gen config <clusterName> https://<endpoint>:6443`
+	// This will overwrite the <endpoint> in your config, while keeping https:// and the port (:6443).
+	EndpointToOverwrite *string
+
+	// OverwriteValue to replace EndpointToOverwrite
+	// Default: NLB DNS name.
+	OverwriteValue *string
+
+	// InstanceType is used to determine the size/arch of the instances.
+	// Default: t3.small (amd64). Meets min specs: https://www.talos.dev/docs/v0.11/introduction/system-requirements/
+	InstanceType awsec2.InstanceType
+
+	// SecurityGroup for the instances.
+	// Default: Generates a new security group, opening port 6443 to any peer. The Talos API (50000, 50001)
+	// is not opened, create the group with SecurityGroupProps.TalosAPIPeers to use talosctl from outside of it
+	SecurityGroup awsec2.SecurityGroup
+
+	// Vpc selects the AWS VPC to deploy your instances into.
+	// Vpc is required and stack will panic if not given.
+	Vpc awsec2.IVpc
+
+	// Subnets to allow the instances to be deployed into
+	// Default: &awsec2.SubnetSelection{SubnetType: awsec2.SubnetType_PUBLIC}
+	SubnetSelection *awsec2.SubnetSelection
+
+	// IAMRole used when launching the instances.
+	// Default: NewControlPlaneIAMRole()
+	IAMRole awsiam.IRole
+
+	// IAMRoleProps configure the default IAMRole (permissions boundary, path, managed policies, name prefix).
+	// Ignored if IAMRole is set.
+	// Default: nil
+	IAMRoleProps *IAMRoleProps
+
+	// InternetFacingNLB determines whether or not the control plane NLB should be
+	// created in public subnets (or left in the private subnets)
+	// Default: jsii.Bool(true)
+	InternetFacingNLB *bool
+
+	// CrossZoneLoadBalancing enables cross-zone load balancing on the control plane NLB.
+	// Default: jsii.Bool(false)
+	CrossZoneLoadBalancing *bool
+
+	// NLBDeletionProtection prevents the control plane NLB from being deleted. Recommended for production clusters.
+	// Default: jsii.Bool(false)
+	NLBDeletionProtection *bool
+
+	// NLBAccessLogs enables access logging on the control plane NLB. It has no effect until a TLS listener is
+	// added to the NLB, see ControlPlaneProps.NLBAccessLogs.
+	// Default: nil (access logs disabled)
+	NLBAccessLogs *NLBAccessLogsProps
+
+	// DualStack adds IPv6 pod and service CIDRs to TalosNodeConfig, gives every instance an IPv6 address, makes
+	// the NLB dualstack and opens the default security group to IPv6. The node and NLB subnets need IPv6 CIDRs.
+	// Default: nil (IPv4 only)
+	DualStack *DualStackProps
+}
+
+type StaticNodeProps struct {
+	// Name of the node, used for the EC2 instance name and the Talos hostname.
+	// Required
+	Name *string
+
+	// CreateEIP allocates an ElasticIP and associates it with the instance.
+	// Default: jsii.Bool(false)
+	CreateEIP *bool
+
+	// Subnet to place the node in.
+	// Default: the next AZ from the control plane SubnetSelection
+	Subnet awsec2.ISubnet
+
+	// InstanceType overrides the control plane InstanceType for this node.
+	InstanceType awsec2.InstanceType
+
+	// ConfigPatch is merged into this node's config (see PatchConfig).
+	// Default: nil
+	ConfigPatch map[string]interface{}
+}
+
+type StaticControlPlane struct {
+	constructs.Construct
+	SecurityGroup awsec2.SecurityGroup
+	Vpc           awsec2.IVpc
+	NLB           awselbv2.NetworkLoadBalancer
+	IAMRole       awsiam.IRole
+
+	// Nodes in the same order as StaticControlPlaneProps.Nodes
+	Nodes []StaticControlPlaneNode
+
+	// AccessLogsBucket receiving the NLB access logs (if enabled)
+	AccessLogsBucket awss3.IBucket
+}
+
+type StaticControlPlaneNode struct {
+	// Name of the node
+	Name *string
+
+	// Instance running the node
+	Instance awsec2.Instance
+
+	// EIP (if allocated/assigned)
+	EIP awsec2.CfnEIP
+}
+
+// GetEIPAddress returns the node's ElasticIP, or nil without CreateEIP
+func (n *StaticControlPlaneNode) GetEIPAddress() *string {
+	if n.EIP == nil {
+		return nil
+	}
+	return n.EIP.Ref()
+}
+
+// GetPrivateIPAddress returns the node's private IP
+func (n *StaticControlPlaneNode) GetPrivateIPAddress() *string {
+	return n.Instance.InstancePrivateIp()
+}
+
+// NewStaticControlPlane creates an NLB and a fixed set of named control plane instances registered
+// directly to its target group. Unlike NewControlPlane, nodes are never replaced by an ASG,
+// and each node can have its own config patch and ElasticIP.
+// Required StaticControlPlaneProps: Vpc, TalosNodeConfig, EndpointToOverwrite (if TransformConfig==true)
+func NewStaticControlPlane(scope constructs.Construct, id *string, props *StaticControlPlaneProps) StaticControlPlane {
+	construct := awscdk.NewConstruct(scope, jsii.String(*id))
+
+	if props.ClusterName == nil {
+		props.ClusterName = jsii.String("talos")
+	}
+
+	if props.Vpc == nil {
+		panic("Vpc is required")
+	}
+
+	if props.TalosNodeConfig == nil {
+		panic("TalosNodeConfig cannot be nil. taloscdk.LoadConfig() can be used to load the needed file.")
+	}
+
+	if props.Nodes == nil {
+		for i := 1; i <= 3; i++ {
+			props.Nodes = append(props.Nodes, StaticNodeProps{Name: jsii.String(fmt.Sprintf("%s-cp-%d", *props.ClusterName, i))})
+		}
+	}
+
+	if props.MachineImageName == nil && props.MachineImageAMI == nil {
+		props.MachineImageName = jsii.String("talos-v0.11.2-*-amd64")
+	}
+
+	if props.SecurityGroup == nil {
+		props.SecurityGroup = NewSecurityGroup(construct, jsii.String("TalosSG"), &SecurityGroupProps{
+			Vpc:       props.Vpc,
+			DualStack: jsii.Bool(props.DualStack != nil),
+		})
+	}
+
+	if props.SubnetSelection == nil {
+		props.SubnetSelection = &awsec2.SubnetSelection{SubnetType: awsec2.SubnetType_PUBLIC}
+	}
+
+	if props.InstanceType == nil {
+		props.InstanceType = awsec2.InstanceType_Of(awsec2.InstanceClass_BURSTABLE3, awsec2.InstanceSize_SMALL)
+	}
+
+	if props.IAMRole == nil {
+		props.IAMRole = NewControlPlaneIAMRole(construct, jsii.String("Role"), props.IAMRoleProps)
+	}
+
+	if props.InternetFacingNLB == nil {
+		props.InternetFacingNLB = jsii.Bool(true)
+	}
+
+	nlbSubnetType := awsec2.SubnetType_PRIVATE
+	if *props.InternetFacingNLB {
+		nlbSubnetType = awsec2.SubnetType_PUBLIC
+	}
+
+	if props.TransformConfig == nil {
+		props.TransformConfig = jsii.Bool(true)
+	}
+
+	nlb := awselbv2.NewNetworkLoadBalancer(construct, jsii.String("CP-NLB"), &awselbv2.NetworkLoadBalancerProps{
+		Vpc:                props.Vpc,
+		InternetFacing:     props.InternetFacingNLB,
+		VpcSubnets:         &awsec2.SubnetSelection{SubnetType: nlbSubnetType},
+		CrossZoneEnabled:   props.CrossZoneLoadBalancing,
+		DeletionProtection: props.NLBDeletionProtection,
+	})
+
+	if props.DualStack != nil {
+		setNLBDualStack(nlb)
+	}
+
+	var accessLogsBucket awss3.IBucket
+	if props.NLBAccessLogs != nil {
+		accessLogsBucket = enableNLBAccessLogs(construct, nlb, props.NLBAccessLogs)
+	}
+
+	if props.OverwriteValue == nil {
+		props.OverwriteValue = nlb.LoadBalancerDnsName()
+	}
+
+	if *props.TransformConfig {
+		if props.EndpointToOverwrite == nil {
+			panic("Requested config transform but missing EndpointToOverwrite.")
+		}
+		props.TalosNodeConfig = TransformConfig(props.TalosNodeConfig, *props.EndpointToOverwrite, *props.OverwriteValue)
+	}
+
+	if props.DualStack != nil {
+		props.TalosNodeConfig = PatchConfig(props.TalosNodeConfig, DualStackConfigPatch(props.DualStack))
+	}
+
+	TagSubnets(props.Vpc)
+
+	targets := newKubernetesAPITargets(construct, nlb, props.Vpc)
+	subnets := subnetsPerAZ(props.Vpc, props.SubnetSelection)
+
+	var nodes []StaticControlPlaneNode
+	for i, nodeProps := range props.Nodes {
+		if nodeProps.Name == nil {
+			panic(fmt.Sprintf("Nodes[%d] is missing a Name", i))
+		}
+
+		if nodeProps.Subnet == nil {
+			nodeProps.Subnet = subnets[i%len(subnets)]
+		}
+
+		if nodeProps.InstanceType == nil {
+			nodeProps.InstanceType = props.InstanceType
+		}
+
+		config := PatchConfig(props.TalosNodeConfig, map[string]interface{}{
+			"machine": map[string]interface{}{
+				"network": map[string]interface{}{"hostname": *nodeProps.Name},
+			},
+		})
+		if nodeProps.ConfigPatch != nil {
+			config = PatchConfig(config, nodeProps.ConfigPatch)
+		}
+
+		nodeConstruct := awscdk.NewConstruct(construct, nodeProps.Name)
+
+		instance := awsec2.NewInstance(nodeConstruct, jsii.String("Instance"), &awsec2.InstanceProps{
+			InstanceName:  nodeProps.Name,
+			InstanceType:  nodeProps.InstanceType,
+			MachineImage:  newMachineImage(props.MachineImageAMI, props.MachineImageName, config),
+			Vpc:           props.Vpc,
+			SecurityGroup: props.SecurityGroup,
+			VpcSubnets:    &awsec2.SubnetSelection{Subnets: &[]awsec2.ISubnet{nodeProps.Subnet}},
+			Role:          props.IAMRole,
+		})
+
+		if props.DualStack != nil {
+			assignIpv6Address(instance)
+		}
+
+		targets.AddTarget(awselbv2targets.NewInstanceTarget(instance, jsii.Number(6443)))
+
+		var eip awsec2.CfnEIP
+		if nodeProps.CreateEIP != nil && *nodeProps.CreateEIP {
+			eip = awsec2.NewCfnEIP(nodeConstruct, jsii.String("EIP"), &awsec2.CfnEIPProps{})
+			eip.ApplyRemovalPolicy(awscdk.RemovalPolicy_DESTROY, nil)
+			awsec2.NewCfnEIPAssociation(nodeConstruct, jsii.String("EIPAssoc"), &awsec2.CfnEIPAssociationProps{InstanceId: instance.InstanceId(), Eip: eip.Ref()})
+		}
+
+		nodes = append(nodes, StaticControlPlaneNode{Name: nodeProps.Name, Instance: instance, EIP: eip})
+	}
+
+	awscdk.Tags_Of(construct).Add(jsii.String(fmt.Sprintf("kubernetes.io/cluster/%s", *props.ClusterName)), jsii.String("owned"), nil)
+
+	return StaticControlPlane{Construct: construct, SecurityGroup: props.SecurityGroup, Vpc: props.Vpc, NLB: nlb, IAMRole: props.IAMRole, Nodes: nodes, AccessLogsBucket: accessLogsBucket}
+}
@@ -21,3 +21,24 @@ func TagSubnets(vpc awsec2.IVpc) {
 		awscdk.Tags_Of(s).Add(jsii.String("kubernetes.io/role/elb"), jsii.String("1"), nil)
 	}
 }
+
+// subnetsPerAZ returns the first selected subnet in each availability zone
+func subnetsPerAZ(vpc awsec2.IVpc, selection *awsec2.SubnetSelection) []awsec2.ISubnet {
+	seen := map[string]bool{}
+	var subnets []awsec2.ISubnet
+
+	for _, s := range *vpc.SelectSubnets(selection).Subnets {
+		az := *s.AvailabilityZone()
+		if seen[az] {
+			continue
+		}
+		seen[az] = true
+		subnets = append(subnets, s)
+	}
+
+	if len(subnets) == 0 {
+		panic("SubnetSelection did not match any subnets")
+	}
+
+	return subnets
+}